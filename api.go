@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// apiServer is an HTTP version of control socket:
+//
+//	GET  /api/status    current player state
+//	GET  /api/queue     tracks in the play queue
+//	GET  /api/results   tag search results
+//	GET  /api/events    player state stream (server-sent events)
+//	POST /api/{command} run command, arguments are sent as json:
+//	                    {"args": ["https://artistname.bandcamp.com"]}
+type apiServer struct {
+	server *http.Server
+}
+
+// host can be omitted from the address, then only local
+// connections are accepted
+func newAPIServer(address string) (*apiServer, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if host == "" {
+		host = "localhost"
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return nil, err
+	}
+
+	api := &apiServer{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/status", api.status)
+	mux.HandleFunc("GET /api/queue", api.queue)
+	mux.HandleFunc("GET /api/results", api.results)
+	mux.HandleFunc("GET /api/events", api.events)
+	mux.HandleFunc("POST /api/{command}", api.command)
+	api.server = &http.Server{Handler: mux}
+
+	go func() {
+		err := api.server.Serve(listener)
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("[err]: http api: %v", err)
+		}
+	}()
+	return api, nil
+}
+
+func (api *apiServer) Close() error {
+	// event streams never end, so there is no graceful shutdown
+	return api.server.Close()
+}
+
+func (api *apiServer) status(w http.ResponseWriter, r *http.Request) {
+	if reply := api.send(w, command{Name: "status"}); reply != nil {
+		writeJSON(w, http.StatusOK, reply.Status)
+	}
+}
+
+func (api *apiServer) queue(w http.ResponseWriter, r *http.Request) {
+	if reply := api.send(w, command{Name: "queue"}); reply != nil {
+		if reply.Queue == nil {
+			reply.Queue = []queueItem{}
+		}
+		writeJSON(w, http.StatusOK, reply.Queue)
+	}
+}
+
+func (api *apiServer) results(w http.ResponseWriter, r *http.Request) {
+	if reply := api.send(w, command{Name: "results"}); reply != nil {
+		if reply.Results == nil {
+			reply.Results = []resultItem{}
+		}
+		writeJSON(w, http.StatusOK, reply.Results)
+	}
+}
+
+// send runs command and writes error response if it failed,
+// nil is returned in that case
+func (api *apiServer) send(w http.ResponseWriter, cmd command) *controlReply {
+	reply := sendCommand(cmd)
+	if !reply.OK {
+		writeJSON(w, http.StatusInternalServerError, &reply)
+		return nil
+	}
+	return &reply
+}
+
+// command only accepts json, so browsers won't send it from
+// other sites without asking first
+func (api *apiServer) command(w http.ResponseWriter, r *http.Request) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		writeJSON(w, http.StatusUnsupportedMediaType,
+			&controlReply{Error: "content type must be application/json"})
+		return
+	}
+
+	var cmd command
+	err := json.NewDecoder(io.LimitReader(r.Body, 64*1024)).Decode(&cmd)
+	if err != nil && !errors.Is(err, io.EOF) {
+		writeJSON(w, http.StatusBadRequest, &controlReply{Error: err.Error()})
+		return
+	}
+	cmd.Name = strings.ToLower(r.PathValue("command"))
+
+	reply := sendCommand(cmd)
+	if !reply.OK {
+		writeJSON(w, http.StatusBadRequest, &reply)
+		return
+	}
+	writeJSON(w, http.StatusOK, &reply)
+}
+
+// events sends current state first, then every change of it
+func (api *apiServer) events(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	states := watchers.subscribe()
+	defer watchers.unsubscribe(states)
+
+	reply := sendCommand(command{Name: "status"})
+	if !reply.OK {
+		writeJSON(w, http.StatusInternalServerError, &reply)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	state := *reply.Status
+	for {
+		data, err := json.Marshal(&state)
+		if err != nil {
+			return
+		}
+		if _, err := fmt.Fprintf(w, "event: status\ndata: %s\n\n", data); err != nil {
+			return
+		}
+		flusher.Flush()
+
+		// watchers could send state that was already sent
+		for last := state; state == last; {
+			select {
+			case <-r.Context().Done():
+				return
+			case s, ok := <-states:
+				if !ok {
+					return
+				}
+				state = s
+			}
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
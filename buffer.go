@@ -0,0 +1,295 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/hajimehoshi/ebiten/v2/audio/mp3"
+)
+
+// amount of downloaded data after which playback can start,
+// roughly 4 seconds of 128 kbps mp3
+const bufferThreshold = 64 * 1024
+
+// streams are always 128 kbps mp3, used to guess size
+// of media if server didn't send it
+const streamBytesPerSecond = 128 * 1000 / 8
+
+// buffer holds partially downloaded media, it can be read while
+// download is still in progress, readers block until requested data
+// arrives or download is over
+type buffer struct {
+	sync.Mutex
+	cond *sync.Cond
+	data []byte
+	done bool
+	err  error
+	// expected size of media, 0 or -1 if unknown
+	length int64
+}
+
+func newBuffer() *buffer {
+	b := &buffer{}
+	b.cond = sync.NewCond(b)
+	return b
+}
+
+func (b *buffer) Write(p []byte) (int, error) {
+	b.Lock()
+	b.data = append(b.data, p...)
+	b.Unlock()
+	b.cond.Broadcast()
+	return len(p), nil
+}
+
+// close marks download as finished, if err is not nil,
+// it will be returned to readers instead of io.EOF
+func (b *buffer) close(err error) {
+	b.Lock()
+	b.done = true
+	b.err = err
+	b.Unlock()
+	b.cond.Broadcast()
+}
+
+func (b *buffer) size() int {
+	b.Lock()
+	defer b.Unlock()
+	return len(b.data)
+}
+
+// returns all data if download was finished successfully
+func (b *buffer) bytes() ([]byte, bool) {
+	b.Lock()
+	defer b.Unlock()
+	return b.data, b.done && b.err == nil
+}
+
+func (b *buffer) newReader() *bufferReader {
+	return &bufferReader{b: b}
+}
+
+// bufferReader is a seekable reader over the growing buffer
+type bufferReader struct {
+	b      *buffer
+	pos    int64
+	closed bool
+}
+
+func (r *bufferReader) Read(p []byte) (int, error) {
+	r.b.Lock()
+	defer r.b.Unlock()
+
+	for r.pos >= int64(len(r.b.data)) && !r.b.done && !r.closed {
+		r.b.cond.Wait()
+	}
+
+	if r.closed {
+		return 0, io.ErrClosedPipe
+	}
+
+	if r.pos >= int64(len(r.b.data)) {
+		if r.b.err != nil {
+			return 0, r.b.err
+		}
+		return 0, io.EOF
+	}
+
+	n := copy(p, r.b.data[r.pos:])
+	r.pos += int64(n)
+	return n, nil
+}
+
+// seeking past downloaded data is allowed, next read will
+// block until data is there
+func (r *bufferReader) Seek(offset int64, whence int) (int64, error) {
+	r.b.Lock()
+	defer r.b.Unlock()
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.pos
+	case io.SeekEnd:
+		if !r.b.done {
+			return r.pos, errors.New("size of the media is not known yet")
+		}
+		offset += int64(len(r.b.data))
+	}
+
+	if offset < 0 {
+		return r.pos, errors.New("negative position")
+	}
+
+	r.pos = offset
+	return r.pos, nil
+}
+
+// Close unblocks pending read, reader can't be used after that
+func (r *bufferReader) Close() error {
+	r.b.Lock()
+	r.closed = true
+	r.b.Unlock()
+	r.b.cond.Broadcast()
+	return nil
+}
+
+// partialDecoder decodes media that is still downloading, seeking
+// restarts decoder at the same relative position in media, streams
+// have constant bitrate, so it lands close enough, reads past
+// downloaded data wait for it
+type partialDecoder struct {
+	reader *bufferReader
+	stream io.Reader // nil after seek, until next read
+	// positions and length of decoded stream
+	pos    int64
+	length int64
+	// size of encoded media
+	size int64
+}
+
+// length of decoded stream is estimated from track duration,
+// size of media is taken from response or estimated too
+func newPartialDecoder(b *buffer, duration float64) (*partialDecoder, int, error) {
+	d := &partialDecoder{reader: b.newReader()}
+	s, err := d.decode()
+	if err != nil {
+		d.reader.Close()
+		return nil, 0, err
+	}
+
+	d.stream = s
+	d.length = int64(duration*float64(s.SampleRate())) * 8
+	d.size = b.length
+	if d.size <= 0 {
+		d.size = int64(duration * streamBytesPerSecond)
+	}
+	return d, s.SampleRate(), nil
+}
+
+// hide Seek from decoder, otherwise it will read whole stream
+// to calculate its length
+func (d *partialDecoder) decode() (*mp3.Stream, error) {
+	return mp3.DecodeF32(struct{ io.Reader }{d.reader})
+}
+
+func (d *partialDecoder) Read(p []byte) (int, error) {
+	if d.stream == nil {
+		if d.pos >= d.length {
+			return 0, io.EOF
+		}
+
+		// position in media is aligned with frames by decoder
+		if _, err := d.reader.Seek(d.pos*d.size/d.length, io.SeekStart); err != nil {
+			return 0, err
+		}
+		s, err := d.decode()
+		if err != nil {
+			return 0, err
+		}
+		d.stream = s
+	}
+
+	n, err := d.stream.Read(p)
+	d.pos += int64(n)
+	return n, err
+}
+
+// Seek doesn't wait for data, it's done on the next read
+func (d *partialDecoder) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += d.pos
+	case io.SeekEnd:
+		offset += d.length
+	}
+
+	if offset < 0 {
+		return d.pos, errors.New("negative position")
+	}
+
+	if offset == d.pos {
+		return d.pos, nil
+	}
+
+	// keep samples of both channels together
+	d.pos = offset - offset%8
+	d.stream = nil
+	return d.pos, nil
+}
+
+// Close unblocks pending read
+func (d *partialDecoder) Close() error {
+	return d.reader.Close()
+}
+
+// number of finished downloads kept in memory, if they
+// didn't fit into cache, enough for current and next tracks
+const keptBuffers = 4
+
+// downloads that are still in progress, and finished ones
+// that couldn't be cached
+type bufferList struct {
+	sync.Mutex
+	buffers map[string]*buffer
+	kept    []string
+}
+
+func newBufferList() *bufferList {
+	return &bufferList{buffers: make(map[string]*buffer)}
+}
+
+func (list *bufferList) set(key string, b *buffer) {
+	list.Lock()
+	list.buffers[key] = b
+	list.unkeep(key)
+	list.Unlock()
+}
+
+// keep leaves finished download in the list instead of cache,
+// the oldest kept downloads are removed
+func (list *bufferList) keep(key string) {
+	list.Lock()
+	defer list.Unlock()
+	list.unkeep(key)
+	list.kept = append(list.kept, key)
+	for len(list.kept) > keptBuffers {
+		delete(list.buffers, list.kept[0])
+		list.kept = list.kept[1:]
+	}
+}
+
+// must be called with lock held
+func (list *bufferList) unkeep(key string) {
+	for i := range list.kept {
+		if list.kept[i] == key {
+			list.kept = append(list.kept[:i], list.kept[i+1:]...)
+			return
+		}
+	}
+}
+
+// returns data of the finished download
+func (list *bufferList) finished(key string) ([]byte, bool) {
+	b, ok := list.get(key)
+	if !ok {
+		return nil, false
+	}
+	return b.bytes()
+}
+
+func (list *bufferList) get(key string) (*buffer, bool) {
+	list.Lock()
+	defer list.Unlock()
+	b, ok := list.buffers[key]
+	return b, ok
+}
+
+func (list *bufferList) remove(key string) {
+	list.Lock()
+	delete(list.buffers, key)
+	list.unkeep(key)
+	list.Unlock()
+}
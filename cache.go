@@ -2,64 +2,329 @@ package main
 
 import (
 	"container/list"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
 	"sync"
+	"time"
 )
 
-type FIFO struct {
-	sync.RWMutex
-	cache map[interface{}][]byte
-	queue *list.List
-	size  int
+// default and smallest size limits of the audio cache in megabytes,
+// any limit should fit at least few long tracks
+const (
+	defaultCacheSize = 1024
+	minCacheSize     = 64
+)
+
+// limit of the cache in bytes, when there is no place for it on disk
+// and data is kept in memory
+const memoryCacheSize = 64 * 1024 * 1024
+
+// temporary files of interrupted writes are removed when cache is
+// loaded, recent ones could still be written by other instance
+const staleTempAge = time.Hour
+
+// size limits of the cover cache, number of decoded images
+// kept in memory and total size of image files on disk
+const (
+	imageMemoryCacheSize = 32
+	imageDiskCacheSize   = 64 * 1024 * 1024
+)
+
+type cacheEntry struct {
+	name string
+	size int64
+	// only used when cache is not backed by disk
+	data []byte
+}
+
+// LRU is a cache stored on disk, every value is kept in a separate
+// file, least recently used files are removed, when total size of
+// the cache exceeds the limit, if dir is empty, data is kept in memory
+type LRU struct {
+	sync.Mutex
+	dir     string
+	entries map[string]*list.Element
+	queue   *list.List
+	total   int64
+	limit   int64
 }
 
-func newCache(size int) *FIFO {
-	return &FIFO{
-		cache: make(map[interface{}][]byte, size),
-		queue: list.New(),
-		size:  size,
+// returns directory for cached files of given type, empty string
+// if there is no suitable place for it
+func getCacheDir(name string) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
 	}
+	return filepath.Join(dir, "gobandcamp", name)
 }
 
-func (fifo *FIFO) set(key interface{}, value []byte) {
-	fifo.Lock()
-	defer fifo.Unlock()
-	//defer fifo.dump()
-	if _, ok := fifo.cache[key]; ok {
-		return
+func newCache(dir string, limit int64) (*LRU, error) {
+	lru := &LRU{
+		dir:     dir,
+		entries: make(map[string]*list.Element),
+		queue:   list.New(),
+		limit:   limit,
 	}
 
-	if len(fifo.cache) < fifo.size {
-		fifo.cache[key] = value
-		fifo.queue.PushBack(key)
-		return
+	if dir == "" {
+		lru.limit = min(limit, memoryCacheSize)
+		return lru, nil
 	}
 
-	enqueue := fifo.queue.Front()
-	delete(fifo.cache, enqueue.Value)
-	fifo.queue.Remove(enqueue)
-	fifo.cache[key] = value
-	fifo.queue.PushBack(key)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		lru.dir = ""
+		lru.limit = min(limit, memoryCacheSize)
+		return lru, err
+	}
+
+	return lru, lru.load()
 }
 
-func (fifo *FIFO) get(key string) ([]byte, bool) {
-	fifo.Lock()
-	//fifo.dump()
-	value, ok := fifo.cache[key]
-	fifo.Unlock()
-	return value, ok
+// load restores cache index from files that are already on disk,
+// modification time is used as time of last access, leftovers
+// of interrupted writes are removed
+func (lru *LRU) load() error {
+	files, err := os.ReadDir(lru.dir)
+	if err != nil {
+		return err
+	}
+
+	var infos []fs.FileInfo
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+
+		if filepath.Ext(file.Name()) == ".tmp" {
+			if time.Since(info.ModTime()) > staleTempAge {
+				os.Remove(filepath.Join(lru.dir, file.Name()))
+			}
+			continue
+		}
+		infos = append(infos, info)
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ModTime().After(infos[j].ModTime())
+	})
+
+	lru.Lock()
+	defer lru.Unlock()
+	for _, info := range infos {
+		entry := &cacheEntry{name: info.Name(), size: info.Size()}
+		lru.entries[entry.name] = lru.queue.PushBack(entry)
+		lru.total += entry.size
+	}
+	lru.evict()
+
+	return nil
+}
+
+// file name is a hash of the key, so any string can be used as a key
+func (lru *LRU) fileName(key string) string {
+	sum := sha1.Sum([]byte(key))
+	return hex.EncodeToString(sum[:])
 }
 
-/*
-func (fifo *FIFO) dump() {
-	enqueue := fifo.queue.Front()
-	for i := 0; i < fifo.size; i++ {
-		var value interface{}
-		value = ""
-		if enqueue != nil {
-			value = enqueue.Value
-			enqueue = enqueue.Next()
+// set returns false if value wasn't stored, it's either
+// larger than the limit or it can't be written to disk
+func (lru *LRU) set(key string, value []byte) bool {
+	name := lru.fileName(key)
+	size := int64(len(value))
+
+	lru.Lock()
+	_, ok := lru.entries[name]
+	lru.Unlock()
+	if ok {
+		return true
+	}
+	if size > lru.limit {
+		return false
+	}
+
+	entry := &cacheEntry{name: name, size: size}
+	if lru.dir == "" {
+		entry.data = value
+	} else if err := lru.write(name, value); err != nil {
+		window.sendEvent(newDebugMessage("failed to write cache file: " + err.Error()))
+		return false
+	}
+
+	lru.Lock()
+	defer lru.Unlock()
+	// same value could be written by other download in the meantime
+	if element, ok := lru.entries[name]; ok {
+		lru.queue.MoveToFront(element)
+		return true
+	}
+	lru.entries[name] = lru.queue.PushFront(entry)
+	lru.total += size
+	lru.evict()
+	return true
+}
+
+// write saves data to temporary file first, so there is never
+// partially written file with valid name in cache directory
+func (lru *LRU) write(name string, value []byte) error {
+	file, err := os.CreateTemp(lru.dir, name+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(value)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+
+	return os.Rename(file.Name(), filepath.Join(lru.dir, name))
+}
+
+func (lru *LRU) get(key string) ([]byte, bool) {
+	name := lru.fileName(key)
+
+	lru.Lock()
+	element, ok := lru.entries[name]
+	if !ok {
+		lru.Unlock()
+		return nil, false
+	}
+	lru.queue.MoveToFront(element)
+	entry := element.Value.(*cacheEntry)
+	lru.Unlock()
+
+	if lru.dir == "" {
+		return entry.data, true
+	}
+
+	path := filepath.Join(lru.dir, name)
+	value, err := os.ReadFile(path)
+	if err != nil {
+		// file was removed by someone else
+		lru.Lock()
+		if element, ok := lru.entries[name]; ok {
+			lru.remove(element)
 		}
-		window.sendEvent(newDebugMessage(value.(string)))
+		lru.Unlock()
+		return nil, false
+	}
+
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	return value, true
+}
+
+// evict removes least recently used entries until cache fits into
+// the limit, must be called with lock held
+func (lru *LRU) evict() {
+	for lru.total > lru.limit {
+		element := lru.queue.Back()
+		if element == nil {
+			return
+		}
+
+		entry := element.Value.(*cacheEntry)
+		if lru.dir != "" {
+			err := os.Remove(filepath.Join(lru.dir, entry.name))
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				window.sendEvent(newDebugMessage("failed to remove cache file: " +
+					err.Error()))
+			}
+		}
+		lru.remove(element)
+	}
+}
+
+// must be called with lock held
+func (lru *LRU) remove(element *list.Element) {
+	entry := element.Value.(*cacheEntry)
+	lru.queue.Remove(element)
+	delete(lru.entries, entry.name)
+	lru.total -= entry.size
+}
+
+type imageEntry struct {
+	key string
+	img image.Image
+}
+
+// imageCache keeps recently shown covers decoded in memory,
+// original files are stored on disk
+type imageCache struct {
+	sync.Mutex
+	images map[string]*list.Element
+	queue  *list.List
+	size   int
+	disk   *LRU
+}
+
+func newImageCache(dir string) (*imageCache, error) {
+	disk, err := newCache(dir, imageDiskCacheSize)
+	return &imageCache{
+		images: make(map[string]*list.Element, imageMemoryCacheSize),
+		queue:  list.New(),
+		size:   imageMemoryCacheSize,
+		disk:   disk,
+	}, err
+}
+
+// same art is available in different sizes
+func getImageKey(artID uint64, imageSize int) string {
+	return fmt.Sprintf("a%d_%d", artID, imageSize)
+}
+
+// get returns decoded image only if it's in memory
+func (cache *imageCache) get(key string) (image.Image, bool) {
+	cache.Lock()
+	defer cache.Unlock()
+	element, ok := cache.images[key]
+	if !ok {
+		return nil, false
+	}
+	cache.queue.MoveToFront(element)
+	return element.Value.(*imageEntry).img, true
+}
+
+// stored returns original image file from disk
+func (cache *imageCache) stored(key string) ([]byte, bool) {
+	return cache.disk.get(key)
+}
+
+// set keeps decoded image in memory, data is written to disk,
+// if it's not nil
+func (cache *imageCache) set(key string, img image.Image, data []byte) {
+	if data != nil {
+		cache.disk.set(key, data)
+	}
+
+	cache.Lock()
+	defer cache.Unlock()
+	if element, ok := cache.images[key]; ok {
+		cache.queue.MoveToFront(element)
+		return
+	}
+
+	// least recently shown image is removed
+	if len(cache.images) >= cache.size {
+		element := cache.queue.Back()
+		delete(cache.images, element.Value.(*imageEntry).key)
+		cache.queue.Remove(element)
 	}
+	cache.images[key] = cache.queue.PushFront(&imageEntry{key: key, img: img})
 }
-*/
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"strings"
 	"sync"
 
@@ -11,7 +12,7 @@ import (
 type contentArea struct {
 	currentModel  int
 	previousModel int
-	models        [6]contentModel
+	models        [10]contentModel
 	port          *views.ViewPort
 	view          views.View
 	style         tcell.Style
@@ -340,8 +341,30 @@ func (content *contentArea) HandleEvent(event tcell.Event) bool {
 					content.toggleModel(helpModel)
 					content.displayMessage()
 				}
+			case 'K', 'k':
+				if !window.hideInput {
+					return false
+				}
+				switch content.currentModel {
+				case playerModel:
+					saveAlbumToLibrary()
+				case releasesModel:
+					saveReleasesToLibrary()
+				default:
+					return false
+				}
+				return true
+			case 'J', 'j':
+				if !window.hideInput || content.currentModel != playerModel {
+					return false
+				}
+				saveArtistToLibrary()
+				return true
 			default:
-				return false
+				if !window.hideInput {
+					return false
+				}
+				return content.handleQueueControls(event.Rune())
 			}
 
 		case tcell.KeyCtrlL:
@@ -354,6 +377,16 @@ func (content *contentArea) HandleEvent(event tcell.Event) bool {
 			content.displayMessage()
 			return true
 
+		case tcell.KeyCtrlR:
+			content.toggleModel(historyModel)
+			content.displayMessage()
+			return true
+
+		case tcell.KeyCtrlO:
+			content.toggleModel(libraryModel)
+			content.displayMessage()
+			return true
+
 		case tcell.KeyEnter:
 
 			if !window.hideInput {
@@ -364,8 +397,8 @@ func (content *contentArea) HandleEvent(event tcell.Event) bool {
 			switch content.currentModel {
 
 			case playlistModel:
-				if window.playlist != nil {
-					if item < len(window.playlist.tracks) {
+				if !window.playlist.isEmpty() {
+					if item < window.playlist.len() {
 						player.setTrack(item)
 					}
 					return true
@@ -378,12 +411,13 @@ func (content *contentArea) HandleEvent(event tcell.Event) bool {
 				// is right before sending
 				if window.searchResults != nil {
 					if item < len(window.searchResults.Results) {
-						if url := window.searchResults.Results[item].ItemURL; url != "" {
+						if result := &window.searchResults.Results[item]; result.ItemURL != "" {
 							// FIXME: condition was changed to work with newer api,
 							// which returns url with url parameter
-							if currentURL := window.getItemURL(); url != currentURL+"?from=discover_page" {
-								wg.Add(1)
-								go processMediaPage(url)
+							// previewed item is opened as a whole
+							if currentURL := window.getItemURL(); result.ItemURL != currentURL+"?from=discover_page" ||
+								window.isPreview() {
+								openResult(result, queueReplace)
 							} else {
 								content.switchModel(playerModel)
 							}
@@ -396,6 +430,44 @@ func (content *contentArea) HandleEvent(event tcell.Event) bool {
 				}
 				return false
 
+			case releasesModel:
+				item, ok := content.models[releasesModel].(*releaseListModel).getRelease()
+				if !ok || item.url == "" {
+					return false
+				}
+				if item.kind == "fan" {
+					window.sendEvent(newMessage("fan pages are not supported"))
+				} else if item.url != window.getItemURL() {
+					downloads.page(item.url)
+				} else {
+					content.switchModel(playerModel)
+				}
+				return true
+
+			case historyModel:
+				if url := content.models[historyModel].(*historyListModel).getURL(); url != "" {
+					downloads.page(url)
+					return true
+				}
+				return false
+
+			case libraryModel:
+				if url := content.models[libraryModel].(*libraryListModel).getURL(); url != "" {
+					downloads.page(url)
+					return true
+				}
+				return false
+
+			case locationsModel:
+				if args, ok := content.models[locationsModel].(*locationListModel).getArgs(); ok && args.radio {
+					downloads.radio(args)
+					return true
+				} else if ok {
+					downloads.search(args)
+					return true
+				}
+				return false
+
 			default:
 				return false
 			}
@@ -422,7 +494,7 @@ func (content *contentArea) HandleEvent(event tcell.Event) bool {
 		}
 
 	case *eventUpdate:
-		if window.playlist == nil {
+		if window.playlist.isEmpty() {
 			model := content.currentModel
 			if model == playerModel || model == playlistModel || model == lyricsModel {
 				content.switchModel(welcomeModel)
@@ -436,8 +508,49 @@ func (content *contentArea) HandleEvent(event tcell.Event) bool {
 		content.displayMessage()
 		return true
 
+	case *eventLibraryFilter:
+		model := content.models[libraryModel].(*libraryListModel)
+		model.filter = event.value()
+		content.switchModel(libraryModel)
+		if model.filter != "" {
+			window.sendEvent(newMessage(fmt.Sprintf("%d items match \"%s\"",
+				len(model.items), model.filter)))
+		} else {
+			content.displayMessage()
+		}
+		return true
+
+	case *eventResultFilter:
+		if window.searchResults == nil {
+			window.sendEvent(newMessage("nothing to filter"))
+			return true
+		}
+
+		filter := event.value()
+		results := filter.apply(window.allResults)
+		if len(results) == 0 {
+			window.sendEvent(newMessage("nothing matches filter: " + filter.String()))
+			return true
+		}
+
+		window.resultFilter = filter
+		window.searchResults.Results = results
+		content.models[resultsModel] = &searchResultsModel{
+			&menuModel{
+				enab: true,
+				hide: true,
+			}}
+		content.switchModel(resultsModel)
+		if filter != nil {
+			window.sendEvent(newMessage(fmt.Sprintf("filter: %s, %d of %d results",
+				filter, len(results), len(window.allResults))))
+		} else {
+			window.sendEvent(newMessage("filter removed"))
+		}
+		return true
+
 	case *eventNewTagSearch:
-		window.searchResults = event.value()
+		window.setSearchResults(event.value())
 		content.models[resultsModel] = &searchResultsModel{
 			&menuModel{
 				enab: true,
@@ -447,36 +560,341 @@ func (content *contentArea) HandleEvent(event tcell.Event) bool {
 		content.displayMessage()
 		return true
 
+	case *eventLocations:
+		args, places := event.value()
+		content.models[locationsModel] = &locationListModel{
+			menuModel: &menuModel{
+				enab:       true,
+				hide:       true,
+				activeItem: -1,
+			},
+			args:   args,
+			places: places,
+		}
+		content.switchModel(locationsModel)
+		window.sendEvent(newMessage(fmt.Sprintf("%d places match \"%s\", choose one",
+			len(places), strings.Join(args.location, " "))))
+		return true
+
+	case *eventNewReleases:
+		window.releases = event.value()
+		content.models[releasesModel] = &releaseListModel{
+			menuModel: &menuModel{
+				enab: true,
+				hide: true,
+			},
+			// label page could have only artists
+			roster: len(window.releases.releases) == 0,
+		}
+		content.switchModel(releasesModel)
+		content.displayMessage()
+		return true
+
 	case *eventAdditionalTagSearch:
 		if value := event.value(); value != nil {
-			window.searchResults.Cursor = value.Cursor
-			window.searchResults.Results = append(window.searchResults.Results,
-				value.Results...)
-			window.searchResults.BatchResultCount += value.BatchResultCount
+			added := window.addSearchResults(value)
 			content.switchModel(resultsModel)
-			window.sendEvent(newMessage("new items added"))
+			if added == 0 {
+				window.sendEvent(newMessage("no new items on the next page"))
+			} else if window.resultFilter != nil {
+				window.sendEvent(newMessage(fmt.Sprintf("filter: %s, %d of %d results",
+					window.resultFilter, len(window.searchResults.Results),
+					len(window.allResults))))
+			} else {
+				window.sendEvent(newMessage("new items added"))
+			}
 		}
 		window.waiting = false
 		return true
 
 	case *eventNewItem:
+		// item was added to the queue, playback didn't change
+		if event.getMode() != queueReplace && event.getMode() != queuePreview &&
+			content.currentModel != welcomeModel {
+			if content.currentModel == playlistModel {
+				content.switchModel(content.currentModel)
+			}
+			return true
+		}
+
+		// preview keeps cursor in the list
+		if event.getMode() == queuePreview && content.currentModel == resultsModel {
+			content.switchModel(resultsModel)
+			return true
+		}
+
 		// switch current model to player or refresh current
 		if content.currentModel == welcomeModel ||
-			content.currentModel == resultsModel {
+			content.currentModel == resultsModel ||
+			content.currentModel == releasesModel {
 			content.toggleModel(content.currentModel)
 		} else {
 			content.switchModel(content.currentModel)
 		}
 		return true
 
-	case *eventNewTrack:
+	case *eventSessionRestored:
+		if content.currentModel == welcomeModel {
+			content.switchModel(playerModel)
+		}
+		return true
+
+	case *eventNewTrack, *eventNextTrack:
 		if content.currentModel != playerModel {
 			content.switchModel(content.currentModel)
+		} else {
+			// next track in queue might be from another album
+			content.refreshCover()
 		}
 	}
 	return false
 }
 
+// openResult plays or queues item of tag search results, tracks
+// are played right away from stream url, if result has one
+func openResult(result *Result, mode queueMode) {
+	if result.ResultType == "t" && result.FeaturedTrack.StreamURL != "" {
+		window.sendEvent(newItem(extractFeaturedTrack(result), mode))
+	} else if mode == queueReplace {
+		downloads.page(result.ItemURL)
+	} else {
+		downloads.queue(result.ItemURL, mode)
+	}
+}
+
+// previewResult plays featured track of the search result right away,
+// list stays on screen, so the next one can be previewed
+func previewResult(result *Result) {
+	if result.FeaturedTrack.StreamURL == "" {
+		window.sendEvent(newMessage("nothing to preview"))
+		return
+	}
+
+	item := extractFeaturedTrack(result)
+	item.preview = true
+	window.sendEvent(newItem(item, queuePreview))
+	window.sendEvent(newMessage("preview: " + item.tracks[0].title))
+}
+
+// queue can be edited from playlist, search results can be added to it
+func (content *contentArea) handleQueueControls(key rune) bool {
+	item := content.GetModel().getItem()
+
+	switch content.currentModel {
+
+	case playlistModel:
+		// cursor follows moved track
+		switch key {
+		case 'x', 'X':
+			window.removeFromQueue(item)
+		case '<', ',':
+			if window.moveInQueue(item, -1) {
+				item--
+			}
+		case '>', '.':
+			if window.moveInQueue(item, 1) {
+				item++
+			}
+		default:
+			return false
+		}
+
+		if window.playlist.isEmpty() {
+			content.switchModel(welcomeModel)
+			return true
+		}
+
+		content.SetModel(playlistModel)
+		content.SetCursorY(item * 3)
+		content.MakeCursorVisible()
+		window.sendEvent(&eventUpdate{})
+		return true
+
+	case resultsModel:
+		if window.searchResults == nil || item >= len(window.searchResults.Results) {
+			return false
+		}
+
+		var mode queueMode
+		switch key {
+		case 'q', 'Q':
+			mode = queueAppend
+		case 'n', 'N':
+			mode = queueNext
+		case 'l', 'L':
+			previewResult(&window.searchResults.Results[item])
+			return true
+		default:
+			return false
+		}
+
+		if result := &window.searchResults.Results[item]; result.ItemURL != "" {
+			openResult(result, mode)
+		} else {
+			window.sendEvent(newMessage("not a media item"))
+		}
+		return true
+
+	case historyModel:
+		var mode queueMode
+		switch key {
+		case 'q', 'Q':
+			mode = queueAppend
+		case 'n', 'N':
+			mode = queueNext
+		default:
+			return false
+		}
+
+		if url := content.models[historyModel].(*historyListModel).getURL(); url != "" {
+			downloads.queue(url, mode)
+			return true
+		}
+		return false
+
+	case releasesModel:
+		model := content.models[releasesModel].(*releaseListModel)
+
+		var mode queueMode
+		switch key {
+		case 'q', 'Q':
+			mode = queueAppend
+		case 'n', 'N':
+			mode = queueNext
+		case 'v', 'V':
+			if !model.toggleRoster() {
+				return false
+			}
+			content.switchModel(releasesModel)
+			if model.roster {
+				window.sendEvent(newMessage("label roster"))
+			} else {
+				window.sendEvent(newMessage("label releases"))
+			}
+			return true
+		default:
+			return false
+		}
+
+		item, ok := model.getRelease()
+		if !ok || item.url == "" {
+			return false
+		}
+
+		// artists, labels and fans can't be queued
+		if !item.isMedia() {
+			window.sendEvent(newMessage("not a media item"))
+			return true
+		}
+
+		downloads.queue(item.url, mode)
+		return true
+
+	case libraryModel:
+		saved, ok := content.models[libraryModel].(*libraryListModel).getSaved()
+		if !ok {
+			return false
+		}
+		url := saved.URL
+
+		switch key {
+		case 'q', 'Q', 'n', 'N':
+			// artists and labels can't be queued
+			if saved.Kind != "" {
+				window.sendEvent(newMessage("not a media item"))
+			} else if key == 'q' || key == 'Q' {
+				downloads.queue(url, queueAppend)
+			} else {
+				downloads.queue(url, queueNext)
+			}
+		case 'x', 'X':
+			if err := library.remove(url); err != nil {
+				window.sendEvent(newErrorMessage(err))
+			}
+			content.SetModel(libraryModel)
+			content.SetCursorY(item * 3)
+			content.MakeCursorVisible()
+			window.sendEvent(&eventUpdate{})
+		default:
+			return false
+		}
+		return true
+	}
+
+	return false
+}
+
+// saveToLibrary saves item, or removes it if it was saved
+func saveToLibrary(item libraryItem) {
+	added, err := library.toggle(item)
+	if err != nil {
+		window.sendEvent(newErrorMessage(err))
+		return
+	}
+
+	if added {
+		window.sendEvent(newMessage(item.Title + " saved to library"))
+	} else {
+		window.sendEvent(newMessage(item.Title + " removed from library"))
+	}
+}
+
+// saveAlbumToLibrary saves album of the current track
+func saveAlbumToLibrary() {
+	item, _ := window.playlist.get(player.currentTrack)
+	if item == nil {
+		return
+	}
+
+	saveToLibrary(libraryItem{
+		URL:    item.url,
+		ArtID:  item.artID,
+		Title:  item.title,
+		Artist: item.artist,
+		Tags:   item.tags,
+	})
+}
+
+// saveArtistToLibrary saves home page of the current album's artist
+func saveArtistToLibrary() {
+	item, _ := window.playlist.get(player.currentTrack)
+	if item == nil {
+		return
+	}
+
+	link := getBandURL(item.url)
+	if link == "" {
+		window.sendEvent(newMessage("artist page is unknown"))
+		return
+	}
+
+	saveToLibrary(libraryItem{
+		URL:   link,
+		Title: item.artist,
+		Kind:  "artist",
+	})
+}
+
+// saveReleasesToLibrary saves artist or label, which
+// discography is shown
+func saveReleasesToLibrary() {
+	list := window.releases
+	if list == nil {
+		return
+	}
+
+	kind := "artist"
+	if list.label {
+		kind = "label"
+	}
+
+	saveToLibrary(libraryItem{
+		URL:   getBandURL(list.url),
+		Title: list.name,
+		Kind:  kind,
+	})
+}
+
 func (content *contentArea) toggleModel(model int) {
 	if content.currentModel != model {
 		content.switchModel(model)
@@ -497,7 +915,7 @@ func (content *contentArea) switchModel(model int) {
 	}
 
 	// don't set these models on empty playlist
-	if window.playlist == nil {
+	if window.playlist.isEmpty() {
 		if model == playerModel || model == playlistModel || model == lyricsModel {
 			model = welcomeModel
 			window.sendEvent(newMessage("nothing to show"))
@@ -513,19 +931,7 @@ func (content *contentArea) switchModel(model int) {
 		window.playerVisible = true
 	}
 
-	if content.currentModel != resultsModel {
-		// TODO: for now, redownload image again
-		// no cache for images yet
-		if url := window.getImageURL(window.getArtID()); url != "" {
-			if window.coverKey != url {
-				window.coverKey = url
-				wg.Add(1)
-				go downloadCover(url)
-			}
-		} else {
-			window.sendEvent(newCoverDownloaded(nil, ""))
-		}
-	}
+	content.refreshCover()
 
 	switch content.currentModel {
 
@@ -536,7 +942,7 @@ func (content *contentArea) switchModel(model int) {
 	case playlistModel:
 		content.SetCursorY(player.currentTrack * 3)
 
-	case resultsModel:
+	case resultsModel, releasesModel:
 		content.previousModel = playerModel
 		model := content.GetModel()
 		content.SetCursorY(model.getItem() * 3)
@@ -547,10 +953,24 @@ func (content *contentArea) switchModel(model int) {
 	window.sendEvent(&eventUpdate{})
 }
 
+// refreshCover shows art of current item, unless list of other
+// items is displayed, they show art of selected item
+func (content *contentArea) refreshCover() {
+	switch content.currentModel {
+	case resultsModel, libraryModel, releasesModel:
+		return
+	}
+
+	if url := window.getImageURL(window.getArtID()); url != window.coverKey ||
+		url == "" {
+		window.loadCover(window.getArtID())
+	}
+}
+
 func (content *contentArea) displayMessage() {
 	switch content.currentModel {
 	case playlistModel:
-		window.sendEvent(newMessage("[Backspace] go back [Ctrl+P] return to player"))
+		window.sendEvent(newMessage("[Backspace] go back [Ctrl+P] return to player [X] remove [<]/[>] move"))
 
 	case lyricsModel:
 		window.sendEvent(newMessage("[Backspace] go back [Ctrl+L] return to player"))
@@ -562,7 +982,28 @@ func (content *contentArea) displayMessage() {
 		window.sendEvent(newMessage("[Backspace] go back [H] return to player"))
 
 	case resultsModel:
-		window.sendEvent(newMessage("[Backspace] return to player"))
+		if window.resultFilter != nil {
+			window.sendEvent(newMessage("filter: " + window.resultFilter.String() +
+				" [Backspace] return to player [L] preview [Q] add to queue [N] play next"))
+		} else {
+			window.sendEvent(newMessage("[Backspace] return to player [L] preview [Q] add to queue [N] play next"))
+		}
+
+	case releasesModel:
+		if window.releases != nil && window.releases.label {
+			window.sendEvent(newMessage("[Backspace] return to player [V] releases/roster [K] save label [Q] add to queue [N] play next"))
+		} else {
+			window.sendEvent(newMessage("[Backspace] return to player [K] save artist [Q] add to queue [N] play next"))
+		}
+
+	case historyModel:
+		window.sendEvent(newMessage("[Backspace] go back [Ctrl+R] return to player [Q] add to queue [N] play next"))
+
+	case libraryModel:
+		window.sendEvent(newMessage("[Backspace] go back [Ctrl+O] return to player [/] filter [X] remove [Q] add to queue [N] play next"))
+
+	case locationsModel:
+		window.sendEvent(newMessage("[Backspace] go back [Enter] search in selected location"))
 	}
 }
 
@@ -574,7 +1015,7 @@ func init() {
 	player := &defaultModel{
 		formatString: "%s\n%s\ue000%s \ue001by \ue000%s\ue001\nreleased %s\n" +
 			"\ue000%s\ue001\n\n%2s %2d/%d - %s\n%s" +
-			"\n%s/%s\nvolume %4s mode %s\n\n\n\n\n%s",
+			"\n%s/%s\nvolume %4s mode %s crossfade %s\n\n\n\n\n%s",
 	}
 
 	lyrics := &textModel{}
@@ -603,6 +1044,18 @@ func init() {
 		activeItem: -1,
 	}}
 
+	played := &historyListModel{menuModel: &menuModel{
+		enab:       true,
+		hide:       true,
+		activeItem: -1,
+	}}
+
+	saved := &libraryListModel{menuModel: &menuModel{
+		enab:       true,
+		hide:       true,
+		activeItem: -1,
+	}}
+
 	contentWidget := NewCellView()
 	contentWidget.models[welcomeModel] = welcome
 	contentWidget.models[playerModel] = player
@@ -610,6 +1063,18 @@ func init() {
 	contentWidget.models[playlistModel] = playlist
 	contentWidget.models[helpModel] = help
 	contentWidget.models[resultsModel] = results
+	contentWidget.models[historyModel] = played
+	contentWidget.models[libraryModel] = saved
+	contentWidget.models[releasesModel] = &releaseListModel{menuModel: &menuModel{
+		enab:       true,
+		hide:       true,
+		activeItem: -1,
+	}}
+	contentWidget.models[locationsModel] = &locationListModel{menuModel: &menuModel{
+		enab:       true,
+		hide:       true,
+		activeItem: -1,
+	}}
 	// contentWidget.switchModel(welcomeModel)
 	contentWidget.previousModel = playerModel
 	window.widgets[content] = contentWidget
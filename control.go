@@ -0,0 +1,376 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// how long external control waits for command to be executed
+const controlTimeout = 5 * time.Second
+
+// command from external control interface, it can be parsed from
+// plain text line ("seek +10") or json ({"command":"seek","args":["+10"]})
+type command struct {
+	Name string   `json:"command"`
+	Args []string `json:"args,omitempty"`
+}
+
+func parseCommand(line string) (command, error) {
+	var cmd command
+	line = strings.TrimSpace(line)
+
+	if strings.HasPrefix(line, "{") {
+		if err := json.Unmarshal([]byte(line), &cmd); err != nil {
+			return cmd, err
+		}
+	} else if fields := strings.Fields(line); len(fields) > 0 {
+		cmd.Name, cmd.Args = fields[0], fields[1:]
+	}
+
+	cmd.Name = strings.ToLower(cmd.Name)
+	if cmd.Name == "" {
+		return cmd, errors.New("empty command")
+	}
+
+	return cmd, nil
+}
+
+// playerState is a snapshot of player and current track
+type playerState struct {
+	Status   string  `json:"status"`
+	Track    int     `json:"track"`
+	Tracks   int     `json:"tracks"`
+	Title    string  `json:"title,omitempty"`
+	Artist   string  `json:"artist,omitempty"`
+	Album    string  `json:"album,omitempty"`
+	Tags     string  `json:"tags,omitempty"`
+	URL      string  `json:"url,omitempty"`
+	ArtURL   string  `json:"art_url,omitempty"`
+	Position float64 `json:"position"`
+	Duration float64 `json:"duration"`
+	Volume   int     `json:"volume"`
+	Muted    bool    `json:"muted"`
+	Mode     string  `json:"mode"`
+	// unix time when current track started playing
+	Started int64 `json:"started,omitempty"`
+}
+
+// queueItem is a single track of the play queue
+type queueItem struct {
+	Track    int     `json:"track"`
+	Title    string  `json:"title"`
+	Artist   string  `json:"artist"`
+	Album    string  `json:"album"`
+	URL      string  `json:"url"`
+	Duration float64 `json:"duration"`
+	Current  bool    `json:"current,omitempty"`
+}
+
+// resultItem is a single item of tag search results
+type resultItem struct {
+	Title  string `json:"title"`
+	Artist string `json:"artist"`
+	Type   string `json:"type"`
+	URL    string `json:"url"`
+}
+
+// controlReply is sent back to the client for every command,
+// queue and search results are only sent when requested
+type controlReply struct {
+	OK      bool         `json:"ok"`
+	Error   string       `json:"error,omitempty"`
+	Status  *playerState `json:"status,omitempty"`
+	Queue   []queueItem  `json:"queue,omitempty"`
+	Results []resultItem `json:"results,omitempty"`
+}
+
+// must be called from the event loop
+func getPlayerState() *playerState {
+	state := &playerState{
+		Status:   "stopped",
+		Tracks:   window.playlist.len(),
+		Position: player.getCurrentTrackPosition().Seconds(),
+		Volume:   int(player.volume*100 + 0.5),
+		Muted:    player.muted,
+		Mode:     player.getPlaybackMode(),
+	}
+
+	switch player.status {
+	case playing, seekBWD, seekFWD:
+		state.Status = "playing"
+	case paused:
+		state.Status = "paused"
+	}
+
+	if item, t := window.playlist.get(player.currentTrack); item != nil {
+		state.Track = player.currentTrack + 1
+		state.Title = t.title
+		state.Artist = item.artist
+		state.Album = item.title
+		state.Tags = item.tags
+		state.URL = item.url
+		state.ArtURL = window.getImageURL(item.artID)
+		state.Duration = t.duration
+	}
+
+	if !player.started.IsZero() {
+		state.Started = player.started.Unix()
+	}
+
+	return state
+}
+
+// must be called from the event loop
+func getQueue() []queueItem {
+	items := make([]queueItem, window.playlist.len())
+	for i := range items {
+		item, t := window.playlist.get(i)
+		items[i] = queueItem{
+			Track:    i + 1,
+			Title:    t.title,
+			Artist:   item.artist,
+			Album:    item.title,
+			URL:      item.url,
+			Duration: t.duration,
+			Current:  i == player.currentTrack,
+		}
+	}
+	return items
+}
+
+// must be called from the event loop
+func getSearchResults() []resultItem {
+	if window.searchResults == nil {
+		return []resultItem{}
+	}
+
+	items := make([]resultItem, len(window.searchResults.Results))
+	for i, result := range window.searchResults.Results {
+		items[i] = resultItem{
+			Title:  result.Title,
+			Artist: result.BandName,
+			Type:   result.ItemType,
+			URL:    result.ItemURL,
+		}
+	}
+	return items
+}
+
+// execute runs command, must be called from the event loop
+func (window *windowLayout) execute(cmd command) controlReply {
+	var err error
+	var reply controlReply
+
+	switch cmd.Name {
+
+	case "status":
+
+	case "play":
+		if player.status != playing {
+			player.playPause()
+		}
+
+	case "pause":
+		if player.status == playing {
+			player.playPause()
+		}
+
+	case "toggle", "play-pause":
+		player.playPause()
+
+	case "stop":
+		player.stop()
+
+	case "next":
+		player.skip(1)
+
+	case "prev", "previous":
+		player.skip(-1)
+
+	case "seek":
+		err = window.seekCommand(cmd.Args)
+
+	case "volume":
+		err = volumeCommand(cmd.Args)
+
+	case "quit":
+		quitApp()
+
+	case "queue":
+		reply.Queue = getQueue()
+
+	case "results":
+		reply.Results = getSearchResults()
+
+	// tags can be given without any options: "search ambient drone"
+	case "search":
+		if len(cmd.Args) == 0 {
+			err = errors.New("tags are missing")
+			break
+		}
+
+		args := cmd.Args
+		if !strings.HasPrefix(args[0], "-") {
+			args = append([]string{"-t"}, args...)
+		}
+		var search arguments
+		search, err = parseSearchArgs(args)
+		if err == nil {
+			downloads.search(search)
+		}
+
+	case "open", "add":
+		if len(cmd.Args) == 0 {
+			err = errors.New("url is missing")
+			break
+		}
+
+		if cmd.Name == "open" {
+			downloads.page(cmd.Args[0])
+		} else {
+			downloads.queue(cmd.Args[0], queueAppend)
+		}
+
+	default:
+		err = fmt.Errorf("unknown command: %q", cmd.Name)
+	}
+
+	window.sendEvent(&eventUpdate{})
+
+	if err != nil {
+		return controlReply{Error: err.Error()}
+	}
+
+	reply.OK = true
+	reply.Status = getPlayerState()
+	return reply
+}
+
+// stateWatchers receive player state every time it changes, slow
+// receivers only get the latest one
+type stateWatchers struct {
+	sync.Mutex
+	last  playerState
+	chans []chan playerState
+}
+
+var watchers = &stateWatchers{}
+
+func (w *stateWatchers) subscribe() chan playerState {
+	w.Lock()
+	defer w.Unlock()
+	ch := make(chan playerState, 1)
+	w.chans = append(w.chans, ch)
+	return ch
+}
+
+func (w *stateWatchers) unsubscribe(ch chan playerState) {
+	w.Lock()
+	defer w.Unlock()
+	for i := range w.chans {
+		if w.chans[i] == ch {
+			w.chans = append(w.chans[:i], w.chans[i+1:]...)
+			close(ch)
+			return
+		}
+	}
+}
+
+func (w *stateWatchers) active() bool {
+	w.Lock()
+	defer w.Unlock()
+	return len(w.chans) > 0
+}
+
+func (w *stateWatchers) update(state *playerState) {
+	w.Lock()
+	defer w.Unlock()
+	if *state == w.last {
+		return
+	}
+	w.last = *state
+
+	for _, ch := range w.chans {
+		// drop state that wasn't received yet
+		select {
+		case <-ch:
+		default:
+		}
+		select {
+		case ch <- *state:
+		default:
+		}
+	}
+}
+
+// playTracker follows single play of the track, position is only
+// counted while playing, so seeking doesn't count as listening
+type playTracker struct {
+	current playerState
+	played  float64
+}
+
+// update returns true if state belongs to the new play,
+// previous one is replaced
+func (t *playTracker) update(state playerState) bool {
+	if state.Started != t.current.Started {
+		t.current = state
+		t.played = 0
+		return true
+	}
+
+	if delta := state.Position - t.current.Position; state.Status == "playing" &&
+		delta > 0 && delta <= 5 {
+		t.played += delta
+	}
+	t.current = state
+	return false
+}
+
+// seek accepts absolute position in seconds or relative one with sign
+func (window *windowLayout) seekCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("position is missing")
+	}
+
+	value, err := strconv.ParseFloat(args[0], 64)
+	if err != nil {
+		return err
+	}
+
+	pos := time.Duration(value * float64(time.Second))
+	if strings.HasPrefix(args[0], "+") || strings.HasPrefix(args[0], "-") {
+		pos += player.getPosition()
+	}
+
+	if pos < 0 {
+		pos = 0
+	}
+
+	return player.seekTo(pos)
+}
+
+// volume accepts value in percents, relative one starts with sign
+func volumeCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("volume is missing")
+	}
+
+	value, err := strconv.ParseFloat(args[0], 64)
+	if err != nil {
+		return err
+	}
+
+	volume := value / 100
+	if strings.HasPrefix(args[0], "+") || strings.HasPrefix(args[0], "-") {
+		volume += player.volume
+	}
+
+	player.changeVolume(volume)
+	return nil
+}
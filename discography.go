@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// release is a single item of the artist discography,
+// or an artist from the label roster
+type release struct {
+	kind   string // album, track, artist, label or fan
+	title  string
+	artist string // location for artists, labels and fans
+	url    string
+	artID  uint64
+}
+
+// isMedia reports whether release can be played or queued
+func (r *release) isMedia() bool {
+	return r.kind == "album" || r.kind == "track"
+}
+
+// releaseList is a list of releases from the artist or label /music
+// page, labels also have roster on /artists page
+type releaseList struct {
+	name     string
+	url      string
+	label    bool
+	releases []release
+	roster   []release
+}
+
+// items of the grid that are not rendered on the page,
+// they are added to it by script
+type clientItem struct {
+	Type    string  `json:"type"`
+	Title   string  `json:"title"`
+	Artist  *string `json:"artist"`
+	PageURL string  `json:"page_url"`
+	ArtID   uint64  `json:"art_id"`
+}
+
+// parseDiscography makes list from the grids of artist or label page,
+// nil is returned if page has neither of them
+func parseDiscography(page *pageData, link string) (*releaseList, error) {
+	if !page.hasGrid && len(page.roster) == 0 {
+		return nil, nil
+	}
+
+	base, err := url.Parse(link)
+	if err != nil {
+		return nil, err
+	}
+
+	list := &releaseList{
+		name:     page.siteName,
+		url:      link,
+		label:    page.label,
+		releases: page.releases,
+		roster:   page.roster,
+	}
+
+	if data, ok := page.data["data-client-items"]; ok {
+		var clientItems []clientItem
+		if err := json.Unmarshal([]byte(data), &clientItems); err != nil {
+			return nil, err
+		}
+
+		for _, item := range clientItems {
+			r := release{
+				kind:  item.Type,
+				title: item.Title,
+				url:   item.PageURL,
+				artID: item.ArtID,
+			}
+			if item.Artist != nil {
+				r.artist = *item.Artist
+			}
+			list.releases = append(list.releases, r)
+		}
+	}
+
+	for i := range list.releases {
+		list.releases[i].url = resolveURL(base, list.releases[i].url)
+		if list.releases[i].artist == "" {
+			list.releases[i].artist = list.name
+		}
+	}
+
+	// roster links have label parameters
+	for i := range list.roster {
+		list.roster[i].url = resolveURL(base, list.roster[i].url)
+		list.roster[i].url, _, _ = strings.Cut(list.roster[i].url, "?")
+	}
+
+	return list, nil
+}
+
+// releases of the artist are linked relative to the page,
+// releases on label pages could be hosted elsewhere
+func resolveURL(base *url.URL, ref string) string {
+	u, err := base.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	return u.String()
+}
+
+// home page of the artist is the root of any of its pages,
+// both for bandcamp subdomains and custom domains
+func getBandURL(link string) string {
+	u, err := url.Parse(link)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// https://f4.bcbits.com/img/a0123456789_2.jpg
+func getArtIDFromURL(link string) uint64 {
+	_, name, found := strings.Cut(link, "/img/a")
+	if !found {
+		return 0
+	}
+	name, _, _ = strings.Cut(name, "_")
+	id, _ := strconv.ParseUint(name, 10, 64)
+	return id
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestParseDiscography(t *testing.T) {
+	page := readPageFixture(t, "artist_music.html")
+
+	list, err := parseDiscography(page, "https://gopher.bandcamp.com/music")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list == nil {
+		t.Fatal("discography was not found")
+	}
+
+	if list.name != "Gopher & Friends" || list.label {
+		t.Errorf(formatStr, "wrong artist", "Gopher & Friends", list.name)
+	}
+
+	want := []release{
+		{
+			kind:   "album",
+			title:  "First & Best",
+			artist: "Guest Gopher",
+			url:    "https://gopher.bandcamp.com/album/first",
+			artID:  456,
+		},
+		{
+			kind:   "track",
+			title:  "Second",
+			artist: "Gopher & Friends",
+			url:    "https://other.bandcamp.com/track/second",
+			artID:  99,
+		},
+		{
+			kind:   "track",
+			title:  "Late & Hidden",
+			artist: "Gopher & Friends",
+			url:    "https://gopher.bandcamp.com/track/late-hidden",
+			artID:  77,
+		},
+	}
+
+	if len(list.releases) != len(want) {
+		t.Fatalf(formatStr, "wrong number of releases", len(want), len(list.releases))
+	}
+
+	for i := range want {
+		if list.releases[i] != want[i] {
+			t.Errorf(formatStr, "wrong release", want[i], list.releases[i])
+		}
+	}
+}
+
+func TestParseLabelRoster(t *testing.T) {
+	page := readPageFixture(t, "label_artists.html")
+
+	list, err := parseDiscography(page, "https://gopherrecords.bandcamp.com/artists")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list == nil || !list.label {
+		t.Fatal("label roster was not found")
+	}
+
+	want := []release{
+		{
+			kind:   "artist",
+			title:  "First Gopher",
+			artist: "Berlin, Germany",
+			url:    "https://first.bandcamp.com",
+		},
+		{
+			kind:  "artist",
+			title: "Second & Co",
+			url:   "https://second.bandcamp.com",
+		},
+	}
+
+	if len(list.roster) != len(want) || len(list.releases) != 0 {
+		t.Fatalf(formatStr, "wrong number of artists", len(want), len(list.roster))
+	}
+
+	for i := range want {
+		if list.roster[i] != want[i] {
+			t.Errorf(formatStr, "wrong artist", want[i], list.roster[i])
+		}
+	}
+}
+
+func TestParseDiscographyAlbumPage(t *testing.T) {
+	page := readPageFixture(t, "album_page.html")
+
+	list, err := parseDiscography(page, "https://gopher.bandcamp.com/album/album_name_test")
+	if list != nil || err != nil {
+		t.Errorf(formatStrLong, "album page should not be a discography",
+			"\n", nil, "\n", nil, "\n", list, "\n", err)
+	}
+}
+
+func TestGetArtIDFromURL(t *testing.T) {
+	tests := []struct {
+		link string
+		want uint64
+	}{
+		{"https://f4.bcbits.com/img/a0123456789_2.jpg", 123456789},
+		{"https://f4.bcbits.com/img/a456_16.jpg", 456},
+		{"https://f4.bcbits.com/img/0011111111_0.jpg", 0},
+		{"", 0},
+	}
+
+	for _, test := range tests {
+		if got := getArtIDFromURL(test.link); got != test.want {
+			t.Errorf(formatStr, "wrong art id for "+test.link, test.want, got)
+		}
+	}
+}
+
+func TestResolveURL(t *testing.T) {
+	base, err := url.Parse("https://gopher.bandcamp.com/music")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{"/album/first", "https://gopher.bandcamp.com/album/first"},
+		{"https://other.bandcamp.com/track/second", "https://other.bandcamp.com/track/second"},
+		{"track/third", "https://gopher.bandcamp.com/track/third"},
+	}
+
+	for _, test := range tests {
+		if got := resolveURL(base, test.ref); got != test.want {
+			t.Errorf(formatStr, "wrong url for "+test.ref, test.want, got)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func readDiscoverFixture(t *testing.T, name string) *DiscoverResult {
+	t.Helper()
+	var result DiscoverResult
+	if err := json.Unmarshal(readFixture(t, name), &result); err != nil {
+		t.Fatal(err)
+	}
+	return &result
+}
+
+func getResultTitles(results []Result) []string {
+	var titles []string
+	for _, result := range results {
+		titles = append(titles, result.Title)
+	}
+	return titles
+}
+
+func TestDiscoverResultDedupe(t *testing.T) {
+	page := readDiscoverFixture(t, "discover_page1.json")
+	page.dedupe()
+
+	want := []string{"First", "Second", "Lone"}
+	if got := getResultTitles(page.Results); !reflect.DeepEqual(got, want) {
+		t.Errorf(formatStr, "wrong results", want, got)
+	}
+	if page.BatchResultCount != 3 {
+		t.Errorf(formatStr, "wrong batch count", 3, page.BatchResultCount)
+	}
+
+	// nothing else is removed second time
+	page.dedupe()
+	if got := getResultTitles(page.Results); !reflect.DeepEqual(got, want) {
+		t.Errorf(formatStr, "results changed on second pass", want, got)
+	}
+	if page.BatchResultCount != 3 {
+		t.Errorf(formatStr, "batch count changed on second pass", 3, page.BatchResultCount)
+	}
+}
+
+// second page repeats items of the first one by id and by url,
+// album with the same id as track is a different item, pages are
+// merged same way as in search results view, filter is applied to
+// the merged results, count includes everything that was fetched
+func TestMergeResults(t *testing.T) {
+	saved := window
+	defer func() { window = saved }()
+	window = &windowLayout{}
+
+	first := readDiscoverFixture(t, "discover_page1.json")
+	second := readDiscoverFixture(t, "discover_page2.json")
+	first.dedupe()
+	second.dedupe()
+
+	window.setSearchResults(first)
+	window.resultFilter = &resultFilter{
+		text:  "no third",
+		tests: []func(*Result) bool{func(r *Result) bool { return r.Title != "Third" }},
+	}
+
+	if added := window.addSearchResults(second); added != 2 {
+		t.Errorf(formatStr, "wrong number of added items", 2, added)
+	}
+
+	want := []string{"First", "Second", "Lone", "Same ID"}
+	if got := getResultTitles(window.searchResults.Results); !reflect.DeepEqual(got, want) {
+		t.Errorf(formatStr, "wrong results", want, got)
+	}
+	all := []string{"First", "Second", "Lone", "Same ID", "Third"}
+	if got := getResultTitles(window.allResults); !reflect.DeepEqual(got, all) {
+		t.Errorf(formatStr, "wrong unfiltered results", all, got)
+	}
+	if count := window.searchResults.BatchResultCount; count != 5 {
+		t.Errorf(formatStr, "wrong batch count", 5, count)
+	}
+	if window.searchResults.Cursor != nil {
+		t.Errorf(formatStr, "cursor of the last page should be nil", nil,
+			*window.searchResults.Cursor)
+	}
+
+	// same page again adds nothing
+	if added := window.addSearchResults(second); added != 0 {
+		t.Errorf(formatStr, "page was added twice", 0, added)
+	}
+	if got := getResultTitles(window.searchResults.Results); !reflect.DeepEqual(got, want) {
+		t.Errorf(formatStr, "results changed after same page", want, got)
+	}
+	if count := window.searchResults.BatchResultCount; count != 5 {
+		t.Errorf(formatStr, "batch count changed after same page", 5, count)
+	}
+}
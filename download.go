@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+type downloadKind int
+
+const (
+	pageDownload downloadKind = iota
+	mediaDownload
+	coverDownload
+	searchDownload
+	queueDownload
+	radioDownload
+)
+
+type job struct {
+	kind   downloadKind
+	cancel context.CancelFunc
+
+	// media only, preloaded tracks are downloaded quietly
+	preload bool
+	track   int
+}
+
+// downloadManager owns every running download, each one can be
+// cancelled, requests for the same key are merged into one download
+type downloadManager struct {
+	sync.Mutex
+	jobs map[string]*job
+}
+
+func newDownloadManager() *downloadManager {
+	return &downloadManager{jobs: make(map[string]*job)}
+}
+
+// run starts f in a new goroutine, unless download with the same key
+// is already running
+func (m *downloadManager) run(key string, j *job, f func(context.Context)) {
+	m.Lock()
+	if _, ok := m.jobs[key]; ok {
+		m.Unlock()
+		window.sendEvent(newDebugMessage("already downloading: " + key))
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	j.cancel = cancel
+	m.jobs[key] = j
+	m.Unlock()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer m.finish(key, j)
+		f(ctx)
+	}()
+}
+
+func (m *downloadManager) finish(key string, j *job) {
+	m.Lock()
+	// job could be cancelled and replaced by new one already
+	if m.jobs[key] == j {
+		delete(m.jobs, key)
+	}
+	m.Unlock()
+	j.cancel()
+}
+
+// cancel stops all downloads of given kind except one with given key,
+// must be called with lock held
+func (m *downloadManager) cancel(kind downloadKind, except string) {
+	for key, j := range m.jobs {
+		if j.kind == kind && key != except {
+			window.sendEvent(newDebugMessage("download cancelled: " + key))
+			j.cancel()
+			delete(m.jobs, key)
+		}
+	}
+}
+
+func (m *downloadManager) cancelAll() {
+	m.Lock()
+	for key, j := range m.jobs {
+		j.cancel()
+		delete(m.jobs, key)
+	}
+	m.Unlock()
+}
+
+// page fetches and parses album/track page, previous page
+// download is cancelled
+func (m *downloadManager) page(link string) {
+	m.Lock()
+	m.cancel(pageDownload, link)
+	m.Unlock()
+
+	m.run(link, &job{kind: pageDownload}, func(ctx context.Context) {
+		processMediaPage(ctx, link, queueReplace)
+	})
+}
+
+// queue fetches album/track page and adds it to the play queue,
+// it doesn't cancel anything
+func (m *downloadManager) queue(link string, mode queueMode) {
+	m.run("queue: "+link, &job{kind: queueDownload}, func(ctx context.Context) {
+		processMediaPage(ctx, link, mode)
+	})
+}
+
+// media downloads track for playback, every other track download is
+// cancelled, preloaded tracks don't cancel anything, if track is already
+// downloading (preloaded), it's download is reused
+func (m *downloadManager) media(link, key string, track int, preload bool) {
+	m.Lock()
+	if !preload {
+		m.cancel(mediaDownload, key)
+	}
+
+	if j, ok := m.jobs[key]; ok {
+		if !preload && j.preload {
+			j.preload = false
+			j.track = track
+		}
+		m.Unlock()
+
+		// might be already enough data to start playback
+		if b, ok := buffers.get(key); !preload && ok && b.size() >= bufferThreshold {
+			window.sendEvent(newTrackBuffered(key))
+		}
+		return
+	}
+	m.Unlock()
+
+	j := &job{kind: mediaDownload, preload: preload, track: track}
+	m.run(key, j, func(ctx context.Context) {
+		downloadMedia(ctx, link, key, j)
+	})
+}
+
+// returns current state of the media download, it can
+// change from preload to regular one while downloading
+func (m *downloadManager) isPreload(j *job) (bool, int) {
+	m.Lock()
+	defer m.Unlock()
+	return j.preload, j.track
+}
+
+// session fetches pages of the queue saved in previous session,
+// it is cancelled as any other page download
+func (m *downloadManager) session(s *session) {
+	m.run("session", &job{kind: pageDownload}, func(ctx context.Context) {
+		fetchSessionItems(ctx, s)
+	})
+}
+
+// cover downloads album art, previous cover download is cancelled
+func (m *downloadManager) cover(link, key string) {
+	m.Lock()
+	m.cancel(coverDownload, link)
+	m.Unlock()
+
+	m.run(link, &job{kind: coverDownload}, func(ctx context.Context) {
+		downloadCover(ctx, link, key)
+	})
+}
+
+// search makes new tag search, previous search is cancelled
+func (m *downloadManager) search(args arguments) {
+	key := fmt.Sprint("search: ", args)
+
+	m.Lock()
+	m.cancel(searchDownload, key)
+	m.Unlock()
+
+	m.run(key, &job{kind: searchDownload}, func(ctx context.Context) {
+		processTagPage(ctx, args)
+	})
+}
+
+// siteSearch makes search of artists, labels, albums and tracks,
+// previous search is cancelled as well
+func (m *downloadManager) siteSearch(query string) {
+	key := "site search: " + query
+
+	m.Lock()
+	m.cancel(searchDownload, key)
+	m.Unlock()
+
+	m.run(key, &job{kind: searchDownload}, func(ctx context.Context) {
+		processSiteSearch(ctx, query)
+	})
+}
+
+// radio starts new radio station, downloads of previous
+// one are cancelled
+func (m *downloadManager) radio(args arguments) {
+	key := fmt.Sprint("radio: ", args)
+
+	m.Lock()
+	m.cancel(radioDownload, key)
+	m.Unlock()
+
+	m.run(key, &job{kind: radioDownload}, func(ctx context.Context) {
+		processRadio(ctx, args)
+	})
+}
+
+// radioPage pulls next page of results for the station
+func (m *downloadManager) radioPage(r *radioStation, req *DiscoverRequest) {
+	m.run("radio page: "+req.String(), &job{kind: radioDownload},
+		func(ctx context.Context) {
+			processRadioPage(ctx, r, req)
+		})
+}
+
+// radioItem fetches album page for the station
+func (m *downloadManager) radioItem(r *radioStation, link string) {
+	m.run("radio item: "+link, &job{kind: radioDownload},
+		func(ctx context.Context) {
+			processRadioItem(ctx, r, link)
+		})
+}
+
+// stopRadio cancels every download of radio station
+func (m *downloadManager) stopRadio() {
+	m.Lock()
+	m.cancel(radioDownload, "")
+	m.Unlock()
+}
+
+// additional pulls next page of current search results
+func (m *downloadManager) additional(req *DiscoverRequest) {
+	m.run("additional: "+req.String(), &job{kind: searchDownload},
+		func(ctx context.Context) {
+			getAdditionalResults(ctx, req)
+		})
+}
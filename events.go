@@ -30,16 +30,40 @@ type textEvents interface {
 type eventNewItem struct {
 	tcell.EventTime
 	album *album
+	mode  queueMode
 }
 
-func newItem(album *album) *eventNewItem {
-	return &eventNewItem{album: album}
+func newItem(album *album, mode queueMode) *eventNewItem {
+	return &eventNewItem{album: album, mode: mode}
 }
 
 func (event *eventNewItem) value() *album {
 	return event.album
 }
 
+func (event *eventNewItem) getMode() queueMode {
+	return event.mode
+}
+
+// pages of the queue from previous session were fetched
+type eventSessionRestored struct {
+	tcell.EventTime
+	session *session
+	items   []*album
+}
+
+func newSessionRestored(session *session, items []*album) *eventSessionRestored {
+	return &eventSessionRestored{session: session, items: items}
+}
+
+func (event *eventSessionRestored) value() *session {
+	return event.session
+}
+
+func (event *eventSessionRestored) getItems() []*album {
+	return event.items
+}
+
 type eventNewTagSearch struct {
 	tcell.EventTime
 	result *DiscoverResult
@@ -66,11 +90,94 @@ func (event *eventAdditionalTagSearch) value() *DiscoverResult {
 	return event.result
 }
 
+type eventNewReleases struct {
+	tcell.EventTime
+	releases *releaseList
+}
+
+func newReleases(releases *releaseList) *eventNewReleases {
+	return &eventNewReleases{releases: releases}
+}
+
+func (event *eventNewReleases) value() *releaseList {
+	return event.releases
+}
+
+// places that match location of tag search, search is
+// made again with the one chosen by user
+type eventLocations struct {
+	tcell.EventTime
+	args   arguments
+	places []geoname
+}
+
+func newLocations(args arguments, places []geoname) *eventLocations {
+	return &eventLocations{args: args, places: places}
+}
+
+func (event *eventLocations) value() (arguments, []geoname) {
+	return event.args, event.places
+}
+
+// first page of the radio station
+type eventRadioStart struct {
+	tcell.EventTime
+	args   arguments
+	result *DiscoverResult
+}
+
+func newRadioStart(args arguments, result *DiscoverResult) *eventRadioStart {
+	return &eventRadioStart{args: args, result: result}
+}
+
+func (event *eventRadioStart) value() (arguments, *DiscoverResult) {
+	return event.args, event.result
+}
+
+// next page of the radio station, nil if it failed to load
+type eventRadioPage struct {
+	tcell.EventTime
+	station *radioStation
+	result  *DiscoverResult
+}
+
+func newRadioPage(station *radioStation, result *DiscoverResult) *eventRadioPage {
+	return &eventRadioPage{station: station, result: result}
+}
+
+func (event *eventRadioPage) value() *DiscoverResult {
+	return event.result
+}
+
+// album that radio station fetched, nil if it failed to load
+type eventRadioItem struct {
+	tcell.EventTime
+	station *radioStation
+	item    *album
+}
+
+func newRadioItem(station *radioStation, item *album) *eventRadioItem {
+	return &eventRadioItem{station: station, item: item}
+}
+
+func (event *eventRadioItem) value() *album {
+	return event.item
+}
+
+// switched is true if player already moved on to preloaded track
 type eventNextTrack struct {
 	tcell.EventTime
+	switched bool
+}
+
+func newNextTrack(switched bool) *eventNextTrack {
+	return &eventNextTrack{switched: switched}
+}
+
+func (event *eventNextTrack) value() bool {
+	return event.switched
 }
 
-// value unused
 type eventNewTrack struct {
 	tcell.EventTime
 	track int
@@ -102,7 +209,7 @@ func (event *eventCoverDownloaded) key() string {
 	return event.url
 }
 
-// cache key = track url
+// cache key of the track
 type eventTrackDownloaded struct {
 	tcell.EventTime
 	key string
@@ -116,6 +223,82 @@ func (event *eventTrackDownloaded) value() string {
 	return event.key
 }
 
+// enough of the track was downloaded to start playback
+type eventTrackBuffered struct {
+	tcell.EventTime
+	key string
+}
+
+func newTrackBuffered(key string) *eventTrackBuffered {
+	return &eventTrackBuffered{key: key}
+}
+
+func (event *eventTrackBuffered) value() string {
+	return event.key
+}
+
+// downloaded track that will be played after current one
+type eventTrackPreloaded struct {
+	tcell.EventTime
+	key   string
+	track int
+}
+
+func newTrackPreloaded(key string, track int) *eventTrackPreloaded {
+	return &eventTrackPreloaded{key: key, track: track}
+}
+
+func (event *eventTrackPreloaded) value() string {
+	return event.key
+}
+
+func (event *eventTrackPreloaded) getTrack() int {
+	return event.track
+}
+
+// command from external control, result is sent to reply
+type eventControl struct {
+	tcell.EventTime
+	cmd   command
+	reply chan controlReply
+}
+
+func newControl(cmd command) *eventControl {
+	return &eventControl{cmd: cmd, reply: make(chan controlReply, 1)}
+}
+
+func (event *eventControl) value() command {
+	return event.cmd
+}
+
+// library view shows only items that match filter
+type eventLibraryFilter struct {
+	tcell.EventTime
+	filter string
+}
+
+func newLibraryFilter(filter string) *eventLibraryFilter {
+	return &eventLibraryFilter{filter: filter}
+}
+
+func (event *eventLibraryFilter) value() string {
+	return event.filter
+}
+
+// nil filter shows all search results again
+type eventResultFilter struct {
+	tcell.EventTime
+	filter *resultFilter
+}
+
+func newResultFilter(filter *resultFilter) *eventResultFilter {
+	return &eventResultFilter{filter: filter}
+}
+
+func (event *eventResultFilter) value() *resultFilter {
+	return event.filter
+}
+
 type eventDebugMessage struct {
 	tcell.EventTime
 	message string
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// resultFilter is applied to already fetched tag search results,
+// every test must pass for result to be shown, order of results
+// is kept, unless sort is set
+type resultFilter struct {
+	text  string
+	tests []func(*Result) bool
+	less  func(a, b *Result) bool
+}
+
+// parseResultFilter reads filter terms, for example:
+// "free price<=5 tracks>=3 minutes<40 date>=2020 location=berlin nopreorder sort=date"
+// words after location are part of it, unless they are filters
+// themselves: "location=new york free"
+func parseResultFilter(terms []string) (*resultFilter, error) {
+	f := &resultFilter{}
+	var location *string
+	var words []string
+
+	for _, term := range terms {
+		if term == "" {
+			continue
+		}
+
+		key, op, value := splitFilterTerm(strings.ToLower(term))
+		if op == "" && location != nil && !isFilterKeyword(key) {
+			*location += " " + key
+			words[len(words)-1] += " " + term
+			continue
+		}
+		location = nil
+
+		switch {
+		case key == "free" && op == "":
+			f.tests = append(f.tests, func(r *Result) bool {
+				return r.IsFreeDownload
+			})
+
+		case key == "nopreorder" && op == "":
+			f.tests = append(f.tests, func(r *Result) bool {
+				return !r.IsAlbumPreorder
+			})
+
+		case key == "price" && op != "":
+			want, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("wrong price: %s", value)
+			}
+			f.tests = append(f.tests, func(r *Result) bool {
+				return compareFilterValue(op, float64(r.Price.Amount)/100.0, want)
+			})
+
+		case key == "tracks" && op != "":
+			want, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("wrong number of tracks: %s", value)
+			}
+			f.tests = append(f.tests, func(r *Result) bool {
+				// tracks don't have track count
+				count := r.TrackCount
+				if r.ResultType == "t" {
+					count = 1
+				}
+				return compareFilterValue(op, float64(count), want)
+			})
+
+		case key == "minutes" && op != "":
+			want, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("wrong duration: %s", value)
+			}
+			f.tests = append(f.tests, func(r *Result) bool {
+				return compareFilterValue(op, r.getDuration()/60.0, want)
+			})
+
+		case key == "date" && op != "":
+			test, err := newDateTest(op, value)
+			if err != nil {
+				return nil, err
+			}
+			f.tests = append(f.tests, test)
+
+		case key == "location" && op == "=":
+			text := value
+			location = &text
+			f.tests = append(f.tests, func(r *Result) bool {
+				return strings.Contains(strings.ToLower(r.BandLocation), text)
+			})
+
+		case key == "sort" && op == "=":
+			less, err := newResultSort(value)
+			if err != nil {
+				return nil, err
+			}
+			f.less = less
+
+		default:
+			return nil, fmt.Errorf("unknown filter: %s", term)
+		}
+
+		words = append(words, term)
+	}
+
+	if len(words) == 0 {
+		return nil, errors.New("filter is empty")
+	}
+
+	f.text = strings.Join(words, " ")
+	return f, nil
+}
+
+// filters that don't have any value
+func isFilterKeyword(key string) bool {
+	return key == "free" || key == "nopreorder"
+}
+
+// first operator splits the term, "<" and ">" could be followed
+// by "=", value could contain operator characters
+func splitFilterTerm(term string) (key, op, value string) {
+	i := strings.IndexAny(term, "<>=")
+	if i < 0 {
+		return term, "", ""
+	}
+
+	op = term[i : i+1]
+	if op != "=" && strings.HasPrefix(term[i+1:], "=") {
+		op += "="
+	}
+	return term[:i], op, term[i+len(op):]
+}
+
+func compareFilterValue(op string, got, want float64) bool {
+	switch op {
+	case "<":
+		return got < want
+	case "<=":
+		return got <= want
+	case ">":
+		return got > want
+	case ">=":
+		return got >= want
+	default:
+		return got == want
+	}
+}
+
+// date is a year, month or day: "2020", "2020-06", "2020-06-15",
+// whole period is included in comparison, "date<=2020" includes
+// releases from december of 2020
+func newDateTest(op, value string) (func(*Result) bool, error) {
+	var start, end time.Time
+	var err error
+
+	switch strings.Count(value, "-") {
+	case 0:
+		start, err = time.Parse("2006", value)
+		end = start.AddDate(1, 0, 0)
+	case 1:
+		start, err = time.Parse("2006-01", value)
+		end = start.AddDate(0, 1, 0)
+	default:
+		start, err = time.Parse("2006-01-02", value)
+		end = start.AddDate(0, 0, 1)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("wrong date: %s", value)
+	}
+
+	return func(r *Result) bool {
+		date, ok := r.getReleaseTime()
+		if !ok {
+			return false
+		}
+
+		switch op {
+		case "<":
+			return date.Before(start)
+		case "<=":
+			return date.Before(end)
+		case ">":
+			return !date.Before(end)
+		case ">=":
+			return !date.Before(start)
+		default:
+			return !date.Before(start) && date.Before(end)
+		}
+	}, nil
+}
+
+// newest releases, longest items and artists in alphabetical
+// order go first, "-" before the name reverses order
+func newResultSort(value string) (func(a, b *Result) bool, error) {
+	name, reverse := strings.CutPrefix(value, "-")
+
+	var less func(a, b *Result) bool
+	switch name {
+	case "date":
+		less = func(a, b *Result) bool {
+			dateA, _ := a.getReleaseTime()
+			dateB, _ := b.getReleaseTime()
+			return dateA.After(dateB)
+		}
+	case "duration":
+		less = func(a, b *Result) bool {
+			return a.getDuration() > b.getDuration()
+		}
+	case "artist":
+		less = func(a, b *Result) bool {
+			return strings.ToLower(a.getArtist()) < strings.ToLower(b.getArtist())
+		}
+	default:
+		return nil, fmt.Errorf("unknown sort: %s", value)
+	}
+
+	if reverse {
+		return func(a, b *Result) bool { return less(b, a) }, nil
+	}
+	return less, nil
+}
+
+func (f *resultFilter) match(r *Result) bool {
+	for _, test := range f.tests {
+		if !test(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// apply returns results that match filter, original slice is
+// not changed, nil filter returns all of them
+func (f *resultFilter) apply(results []Result) []Result {
+	filtered := make([]Result, 0, len(results))
+	for i := range results {
+		if f == nil || f.match(&results[i]) {
+			filtered = append(filtered, results[i])
+		}
+	}
+
+	if f != nil && f.less != nil {
+		sort.SliceStable(filtered, func(i, j int) bool {
+			return f.less(&filtered[i], &filtered[j])
+		})
+	}
+	return filtered
+}
+
+func (f *resultFilter) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.text
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitFilterTerm(t *testing.T) {
+	tests := []struct {
+		term           string
+		key, op, value string
+	}{
+		{"price<=5", "price", "<=", "5"},
+		{"price<5", "price", "<", "5"},
+		{"tracks>=3", "tracks", ">=", "3"},
+		{"tracks>3", "tracks", ">", "3"},
+		{"date=2020", "date", "=", "2020"},
+		{"free", "free", "", ""},
+		// only first operator splits the term
+		{"location=a<b", "location", "=", "a<b"},
+		{"price<=>5", "price", "<=", ">5"},
+		{"=5", "", "=", "5"},
+	}
+
+	for _, test := range tests {
+		key, op, value := splitFilterTerm(test.term)
+		if key != test.key || op != test.op || value != test.value {
+			t.Errorf(formatStr, "wrong split of "+test.term,
+				[]string{test.key, test.op, test.value}, []string{key, op, value})
+		}
+	}
+}
+
+func TestParseResultFilter(t *testing.T) {
+	tests := []struct {
+		terms []string
+		text  string
+		fails bool
+	}{
+		{[]string{"free", "", "price<=5"}, "free price<=5", false},
+		{[]string{"sort=-date"}, "sort=-date", false},
+		{[]string{}, "", true},
+		{[]string{"location"}, "", true},
+		{[]string{"price<=cheap"}, "", true},
+		{[]string{"date>=2020-13"}, "", true},
+		{[]string{"sort=price"}, "", true},
+		{[]string{"york"}, "", true},
+	}
+
+	for _, test := range tests {
+		f, err := parseResultFilter(test.terms)
+		if test.fails {
+			if err == nil {
+				t.Errorf(formatStr, "should fail", test.terms, f)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf(formatStr, "unexpected error", test.terms, err)
+		} else if f.String() != test.text {
+			t.Errorf(formatStr, "wrong filter text", test.text, f.String())
+		}
+	}
+}
+
+func TestResultFilterLocation(t *testing.T) {
+	results := []Result{
+		{Title: "a", BandLocation: "New York, New York"},
+		{Title: "b", BandLocation: "York, UK"},
+		{Title: "c", BandLocation: "Newcastle, UK"},
+		{Title: "d"},
+		{Title: "e", BandLocation: "New York, New York", IsAlbumPreorder: true},
+		{Title: "f", BandLocation: "Berlin, Germany", IsAlbumPreorder: true},
+		{Title: "g", BandLocation: "Berlin, Germany", IsFreeDownload: true},
+	}
+
+	tests := []struct {
+		terms []string
+		want  []string
+	}{
+		{[]string{"location=New", "York"}, []string{"a", "e"}},
+		// keywords end location
+		{[]string{"location=new", "york", "nopreorder"}, []string{"a"}},
+		{[]string{"location=berlin", "nopreorder", "sort=date"}, []string{"g"}},
+		{[]string{"location=berlin", "free"}, []string{"g"}},
+		{[]string{"nopreorder", "location=germany"}, []string{"g"}},
+	}
+
+	for _, test := range tests {
+		f, err := parseResultFilter(test.terms)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := getResultTitles(f.apply(results)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf(formatStr, f.String(), test.want, got)
+		}
+	}
+}
+
+func TestResultFilterDate(t *testing.T) {
+	tests := []struct {
+		term string
+		date string
+		want bool
+	}{
+		// whole year, month or day is included
+		{"date<=2020", "31 Dec 2020 23:00:00 GMT", true},
+		{"date<=2020", "01 Jan 2021 00:00:00 GMT", false},
+		{"date<2020", "31 Dec 2019 00:00:00 GMT", true},
+		{"date<2020", "01 Jan 2020 00:00:00 GMT", false},
+		{"date>2020-06", "30 Jun 2020 00:00:00 GMT", false},
+		{"date>2020-06", "01 Jul 2020 00:00:00 GMT", true},
+		{"date>=2020-06", "01 Jun 2020 00:00:00 GMT", true},
+		{"date>=2020-06", "31 May 2020 00:00:00 GMT", false},
+		{"date=2020-06-15", "15 Jun 2020 12:00:00 GMT", true},
+		{"date=2020-06-15", "16 Jun 2020 00:00:00 GMT", false},
+		{"date=2020", "2020-03-01 00:00:00 UTC", true},
+		// undated results never match
+		{"date>=2000", "", false},
+	}
+
+	for _, test := range tests {
+		f, err := parseResultFilter([]string{test.term})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := f.match(&Result{ReleaseDate: test.date}); got != test.want {
+			t.Errorf(formatStr, test.term+" of "+test.date, test.want, got)
+		}
+	}
+}
+
+func TestResultFilterSort(t *testing.T) {
+	results := []Result{
+		{Title: "short", Duration: 60, BandName: "b",
+			ReleaseDate: "01 Jan 2019 00:00:00 GMT"},
+		{Title: "long", Duration: 600, BandName: "C",
+			ReleaseDate: "01 Jan 2018 00:00:00 GMT"},
+		{Title: "middle", Duration: 300, BandName: "a",
+			ReleaseDate: "01 Jan 2020 00:00:00 GMT"},
+	}
+
+	tests := []struct {
+		sort string
+		want []string
+	}{
+		{"sort=duration", []string{"long", "middle", "short"}},
+		{"sort=-duration", []string{"short", "middle", "long"}},
+		{"sort=date", []string{"middle", "short", "long"}},
+		{"sort=-date", []string{"long", "short", "middle"}},
+		{"sort=artist", []string{"middle", "short", "long"}},
+		{"sort=-artist", []string{"long", "short", "middle"}},
+	}
+
+	for _, test := range tests {
+		f, err := parseResultFilter([]string{test.sort})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := getResultTitles(f.apply(results)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf(formatStr, test.sort, test.want, got)
+		}
+	}
+
+	// original order is kept
+	want := []string{"short", "long", "middle"}
+	if got := getResultTitles(results); !reflect.DeepEqual(got, want) {
+		t.Errorf(formatStr, "results were changed", want, got)
+	}
+}
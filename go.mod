@@ -4,6 +4,7 @@ go 1.23.9
 
 require (
 	github.com/gdamore/tcell/v2 v2.8.1
+	github.com/godbus/dbus/v5 v5.2.2
 	github.com/hajimehoshi/ebiten/v2 v2.9.0-alpha.5
 	github.com/nfnt/resize v0.0.0-20180221191011-83c6a9932646
 	github.com/olde-ducke/image2ascii v1.0.2-0.20211121074350-7020fab00c5f
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"log"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// same size as event queue of tcell screen
+const headlessQueueSize = 128
+
+// initHeadless prepares event queue for headless mode, there is
+// no screen and no widgets, events that change playback are handled
+// in runHeadless, messages are written to the log
+func initHeadless() {
+	window.headless = true
+	window.events = make(chan tcell.Event, headlessQueueSize)
+	window.done = make(chan struct{})
+}
+
+// post never blocks sender, which could be the event loop itself,
+// if queue is full, event waits in the background
+func (window *windowLayout) post(event tcell.Event) {
+	select {
+	case window.events <- event:
+	default:
+		go func() {
+			select {
+			case window.events <- event:
+			case <-window.done:
+			}
+		}()
+	}
+}
+
+func runHeadless(quit chan int) {
+	defer wg.Done()
+
+	// there is no screen to wait for
+	if s := window.session; s != nil {
+		window.session = nil
+		s.restore()
+	}
+
+	for {
+		select {
+		case event := <-window.events:
+			window.handleHeadless(event)
+		case <-window.done:
+			quit <- 0
+			return
+		}
+	}
+}
+
+// handleHeadless processes events that change player, queue or
+// search results, everything else is only drawn on screen
+func (window *windowLayout) handleHeadless(event tcell.Event) {
+	switch event := event.(type) {
+
+	case *eventMessage:
+		log.Println("[msg]:", event)
+
+	case *eventErrorMessage:
+		log.Println("[err]:", event)
+
+	case *eventNewTagSearch:
+		window.setSearchResults(event.value())
+
+	case *eventAdditionalTagSearch:
+		if value := event.value(); value != nil {
+			window.addSearchResults(value)
+		}
+		window.waiting = false
+
+	case *eventLocations:
+		_, places := event.value()
+		log.Printf("[msg]: %d places match location, use geoname id instead",
+			len(places))
+
+	case *eventNewReleases:
+		log.Println("[msg]: discography can't be browsed in headless mode")
+
+	case *eventNewItem, *eventRadioStart, *eventRadioPage, *eventRadioItem,
+		*eventControl, *eventSessionRestored, *eventNewTrack, *eventNextTrack,
+		*eventTrackPreloaded, *eventTrackBuffered, *eventTrackDownloaded,
+		*eventUpdate:
+		window.HandleEvent(event)
+	}
+}
+
+// quitApp stops event loop of either mode
+func quitApp() {
+	if window.headless {
+		window.quit.Do(func() { close(window.done) })
+		return
+	}
+	app.Quit()
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// number of recent plays that are kept in memory for history view,
+// full history is only read for export
+const historyViewSize = 500
+
+// play is counted as skipped if it ended before this part of the track
+const skipThreshold = 0.9
+
+// historyEntry is a single play of the track
+type historyEntry struct {
+	Time     time.Time `json:"time"`
+	URL      string    `json:"url"`
+	Title    string    `json:"title"`
+	Artist   string    `json:"artist"`
+	Album    string    `json:"album"`
+	Tags     string    `json:"tags,omitempty"`
+	Listened float64   `json:"listened"`
+	Duration float64   `json:"duration"`
+	Skipped  bool      `json:"skipped"`
+}
+
+// historyStore records every play of the track, entries are appended
+// to the file as json lines
+type historyStore struct {
+	sync.Mutex
+	path    string
+	entries []historyEntry
+
+	states  chan playerState
+	tracker playTracker
+	wg      sync.WaitGroup
+}
+
+// directory for user data, that is not a cache or configuration,
+// XDG_DATA_HOME or ~/.local/share on unix systems
+func getDataDir() (string, error) {
+	if dir := os.Getenv("XDG_DATA_HOME"); filepath.IsAbs(dir) {
+		return filepath.Join(dir, "gobandcamp"), nil
+	}
+
+	switch runtime.GOOS {
+	case "windows", "darwin", "ios", "plan9":
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(dir, "gobandcamp"), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "share", "gobandcamp"), nil
+}
+
+func getHistoryPath() (string, error) {
+	dir, err := getDataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "history.jsonl"), nil
+}
+
+// newHistory loads recent entries and starts recording plays
+func newHistory() (*historyStore, error) {
+	h := &historyStore{}
+
+	path, err := getHistoryPath()
+	if err == nil {
+		h.path = path
+		h.entries, err = readHistory(path, historyViewSize)
+	}
+
+	h.states = watchers.subscribe()
+	h.wg.Add(1)
+	go h.watch()
+	return h, err
+}
+
+// Close records current play
+func (h *historyStore) Close() {
+	watchers.unsubscribe(h.states)
+	h.wg.Wait()
+	h.record(h.tracker.current, h.tracker.played)
+}
+
+func (h *historyStore) watch() {
+	defer h.wg.Done()
+
+	for state := range h.states {
+		last, played := h.tracker.current, h.tracker.played
+		if h.tracker.update(state) {
+			h.record(last, played)
+		}
+	}
+}
+
+// record adds play that ended with given state
+func (h *historyStore) record(state playerState, played float64) {
+	if state.Started == 0 || state.Track == 0 {
+		return
+	}
+
+	entry := historyEntry{
+		Time:     time.Unix(state.Started, 0),
+		URL:      state.URL,
+		Title:    state.Title,
+		Artist:   state.Artist,
+		Album:    state.Album,
+		Tags:     state.Tags,
+		Listened: math.Round(played),
+		Duration: state.Duration,
+		Skipped:  state.Position < state.Duration*skipThreshold,
+	}
+
+	if err := h.add(entry); err != nil {
+		log.Printf("[err]: history: %v", err)
+	}
+}
+
+func (h *historyStore) add(entry historyEntry) error {
+	h.Lock()
+	h.entries = append(h.entries, entry)
+	if len(h.entries) > historyViewSize {
+		h.entries = h.entries[len(h.entries)-historyViewSize:]
+	}
+	h.Unlock()
+
+	if h.path == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(h.path), 0o755); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(&entry)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(h.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(append(data, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// recent returns recent entries, the latest one goes first
+func (h *historyStore) recent() []historyEntry {
+	h.Lock()
+	defer h.Unlock()
+
+	entries := make([]historyEntry, len(h.entries))
+	for i, entry := range h.entries {
+		entries[len(entries)-1-i] = entry
+	}
+	return entries
+}
+
+// readHistory reads last entries from the history file, all of them
+// if limit is 0, broken lines are skipped
+func readHistory(path string, limit int) ([]historyEntry, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []historyEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry historyEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+
+		entries = append(entries, entry)
+		if limit > 0 && len(entries) > limit {
+			entries = entries[1:]
+		}
+	}
+
+	return entries, scanner.Err()
+}
+
+// runHistory is a "history" mode, it exports full history
+func runHistory(args []string) int {
+	f := flag.NewFlagSet("history", flag.ContinueOnError)
+	f.SetOutput(os.Stderr)
+	format := f.String("format", "json", "output `format`: json or csv")
+	output := f.String("o", "", "write to `file` instead of stdout")
+	f.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s history [-format json|csv] [-o file]\n\n",
+			os.Args[0])
+		f.PrintDefaults()
+	}
+
+	if err := f.Parse(args); err != nil {
+		return 2
+	}
+
+	if f.NArg() > 0 || (*format != "json" && *format != "csv") {
+		f.Usage()
+		return 2
+	}
+
+	path, err := getHistoryPath()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	entries, err := readHistory(path, 0)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer file.Close()
+		w = file
+	}
+
+	if *format == "csv" {
+		err = exportHistoryCSV(w, entries)
+	} else {
+		err = exportHistoryJSON(w, entries)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func exportHistoryJSON(w io.Writer, entries []historyEntry) error {
+	if entries == nil {
+		entries = []historyEntry{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "    ")
+	return enc.Encode(entries)
+}
+
+func exportHistoryCSV(w io.Writer, entries []historyEntry) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"time", "url", "title", "artist", "album", "tags",
+		"listened", "duration", "skipped"})
+
+	for _, entry := range entries {
+		cw.Write([]string{
+			entry.Time.Format(time.RFC3339),
+			entry.URL,
+			entry.Title,
+			entry.Artist,
+			entry.Album,
+			entry.Tags,
+			strconv.FormatFloat(entry.Listened, 'f', -1, 64),
+			strconv.FormatFloat(entry.Duration, 'f', -1, 64),
+			strconv.FormatBool(entry.Skipped),
+		})
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
@@ -119,14 +119,71 @@ type arguments struct {
 	location []string
 	sort     string
 	format   Format
+	types    []string
 	flag     int
+	// radio only, whole albums instead of featured tracks
+	radio   bool
+	album   bool
+	shuffle bool
+	// resolved location, or picked by user
+	geonameID int64
 }
 
 func parseInput(input string) {
 	commands := strings.Split(input, " ")
 	if strings.Contains(commands[0], "http://") || strings.Contains(commands[0], "https://") {
-		wg.Add(1)
-		go processMediaPage(commands[0])
+		downloads.page(commands[0])
+		return
+	} else if len(commands) > 1 && (commands[0] == "-a" || commands[0] == "--add") {
+		downloads.queue(commands[1], queueAppend)
+		return
+	} else if len(commands) > 1 && (commands[0] == "-n" || commands[0] == "--next") {
+		downloads.queue(commands[1], queueNext)
+		return
+	} else if len(commands) > 1 && (commands[0] == "-q" || commands[0] == "--search") {
+		query := strings.Join(strings.Fields(strings.Join(commands[1:], " ")), " ")
+		if query == "" {
+			window.sendEvent(newErrorMessage(errors.New("empty search query")))
+			return
+		}
+		downloads.siteSearch(query)
+		return
+	} else if len(commands) > 1 && (commands[0] == "-r" || commands[0] == "--radio") {
+		if commands[1] == "off" || commands[1] == "stop" {
+			window.stopRadio()
+			return
+		}
+
+		// tags can be given without any options, same as in ctl search
+		args := commands[1:]
+		if !strings.HasPrefix(args[0], "-") {
+			args = append([]string{"-t"}, args...)
+		}
+		radio, err := parseSearchArgs(args)
+		if err != nil {
+			window.sendEvent(newErrorMessage(err))
+			return
+		}
+		radio.radio = true
+		downloads.radio(radio)
+		return
+	} else if commands[0] == "-F" || commands[0] == "--filter" {
+		// without any terms filter is removed
+		terms := strings.Fields(input)[1:]
+		if len(terms) == 0 || terms[0] == "off" {
+			window.sendEvent(newResultFilter(nil))
+			return
+		}
+
+		filter, err := parseResultFilter(terms)
+		if err != nil {
+			window.sendEvent(newErrorMessage(err))
+			return
+		}
+		window.sendEvent(newResultFilter(filter))
+		return
+	} else if strings.HasPrefix(input, "/") {
+		window.sendEvent(newLibraryFilter(strings.TrimPrefix(input, "/")))
 		return
 	} else if commands[0] == "exit" || commands[0] == "q" || commands[0] == "quit" {
 		app.Quit()
@@ -136,9 +193,21 @@ func parseInput(input string) {
 		return
 	}
 
+	args, err := parseSearchArgs(commands)
+	if err != nil {
+		window.sendEvent(newErrorMessage(err))
+		return
+	}
+	downloads.search(args)
+}
+
+// parseSearchArgs reads tag search options, words that
+// don't follow any of the options are ignored
+func parseSearchArgs(commands []string) (arguments, error) {
 	args := arguments{
-		sort: "top",
-		tags: []string{},
+		sort:  "top",
+		tags:  []string{},
+		types: []string{"a"},
 	}
 
 	for i := 0; i < len(commands); i++ {
@@ -152,6 +221,12 @@ func parseInput(input string) {
 				args.flag = 3
 			case "-f", "--format":
 				args.flag = 4
+			case "--type":
+				args.flag = 5
+			case "-p", "--play":
+				args.flag = 6
+			case "-o", "--order":
+				args.flag = 7
 			default:
 				args.flag = 0
 			}
@@ -184,12 +259,26 @@ func parseInput(input string) {
 				if args.format == TShirts {
 					args.format = All
 				}
+			case 5:
+				switch commands[i] {
+				case "track", "tracks":
+					args.types = []string{"t"}
+				case "all":
+					args.types = []string{"a", "t"}
+				case "album", "albums":
+					args.types = []string{"a"}
+				default:
+					return args, fmt.Errorf("unknown result type: %s", commands[i])
+				}
+			case 6:
+				args.album = commands[i] == "album" || commands[i] == "albums"
+			case 7:
+				args.shuffle = commands[i] == "shuffle" || commands[i] == "random"
 			}
 		}
 	}
 
-	wg.Add(1)
-	go processTagPage(args)
+	return args, nil
 }
 
 // initialize widget
@@ -21,9 +21,12 @@ type album struct {
 	tags        string
 	totalTracks int
 	tracks      []track
+	// only featured track of the search result
+	preview bool
 }
 
 type track struct {
+	id          uint64
 	trackNumber int
 	title       string
 	duration    float64
@@ -80,6 +83,7 @@ type media struct {
 	ArtId     uint64 `json:"art_id"`
 	URL       string `json:"url"` // either album or track URL
 	Trackinfo []struct {
+		ID       uint64  `json:"id"`       // track id, doesn't change unlike media url
 		Duration float64 `json:"duration"` // duration in seconds
 		File     struct {
 			MP3128 string `json:"mp3-128"` // media url
@@ -125,6 +129,7 @@ func extractAlbum(metadata *trAlbum, mediadata *media) (*album, error) {
 		for i, item := range metadata.Tracks.ItemListElement {
 			albumMetadata.tracks = append(albumMetadata.tracks,
 				track{
+					id:          mediadata.Trackinfo[i].ID,
 					trackNumber: item.Position,
 					title:       item.TrackInfo.Name,
 					duration:    mediadata.Trackinfo[i].Duration,
@@ -158,6 +163,7 @@ func extractTrack(metadata *trAlbum, mediadata *media) (*album, error) {
 	if len(mediadata.Trackinfo) > 0 {
 		albumMetadata.tracks = append(albumMetadata.tracks,
 			track{
+				id:          mediadata.Trackinfo[0].ID,
 				trackNumber: 1,
 				title:       metadata.Name,
 				duration:    mediadata.Trackinfo[0].Duration,
@@ -178,12 +184,17 @@ func parseDate(input string) (strDate string) {
 		window.sendEvent(newErrorMessage(err))
 		strDate = "---"
 	} else {
-		y, m, d := date.Date()
-		strDate = fmt.Sprintf("%s %d, %4d", m, d, y)
+		strDate = formatDate(date)
 	}
 	return strDate
 }
 
+// same format for pages and search results
+func formatDate(date time.Time) string {
+	y, m, d := date.Date()
+	return fmt.Sprintf("%s %d, %4d", m, d, y)
+}
+
 // tag search results
 type tagSearchJSON struct {
 	Hubs Hub `json:"hub"`
@@ -348,6 +359,85 @@ type Result struct {
 	IsFollowingBand bool             `json:"is_following_band"`
 }
 
+// album artist is only set if it's not the band
+func (result *Result) getArtist() string {
+	if result.AlbumArtist != nil {
+		return *result.AlbumArtist
+	}
+	return result.BandName
+}
+
+// track results have only duration of their featured track
+func (result *Result) getDuration() float64 {
+	if result.Duration == 0 && result.ResultType == "t" {
+		return result.FeaturedTrack.Duration
+	}
+	return result.Duration
+}
+
+// search results are not always dated
+func (result *Result) getReleaseTime() (time.Time, bool) {
+	for _, layout := range []string{"02 Jan 2006 15:04:05 MST", "2006-01-02 15:04:05 MST"} {
+		if date, err := time.Parse(layout, result.ReleaseDate); err == nil {
+			return date, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// same item is sometimes listed several times, both id and url
+// are checked, since either could be missing, ids of albums and
+// tracks are not unique between each other
+func (result *Result) getKeys() (string, string) {
+	var id string
+	if result.ItemID != 0 {
+		id = fmt.Sprintf("%s%d", result.ResultType, result.ItemID)
+	}
+	url, _, _ := strings.Cut(result.ItemURL, "?")
+	return id, url
+}
+
+// extractFeaturedTrack makes item from featured track of tag search
+// result, it's played from stream url without fetching the page,
+// track results feature themselves, albums feature one of their tracks
+func extractFeaturedTrack(result *Result) *album {
+	url, _, _ := strings.Cut(result.ItemURL, "?")
+
+	title := result.FeaturedTrack.Title
+	if result.ResultType == "t" || title == "" {
+		title = result.Title
+	}
+
+	return &album{
+		album:       false,
+		single:      result.ResultType == "t",
+		artID:       result.PrimaryImage.ImageId,
+		title:       result.Title,
+		artist:      result.getArtist(),
+		date:        parseResultDate(result),
+		url:         url,
+		totalTracks: 1,
+		tracks: []track{
+			{
+				id:          result.FeaturedTrack.ID,
+				trackNumber: 1,
+				title:       title,
+				duration:    result.FeaturedTrack.Duration,
+				url:         result.FeaturedTrack.StreamURL,
+			},
+		},
+	}
+}
+
+// same as parseDate, but without error message
+func parseResultDate(result *Result) string {
+	date, ok := result.getReleaseTime()
+	if !ok {
+		return "---"
+	}
+	return formatDate(date)
+}
+
 type DiscoverResult struct {
 	Request                 *DiscoverRequest `json:"-"`
 	Results                 []Result         `json:"results"`
@@ -360,6 +450,43 @@ type DiscoverResult struct {
 	ErrorType               string           `json:"error_type,omitempty"`
 }
 
+// mergeResults appends results of the next page to already listed
+// ones, items that are listed already are skipped, number of
+// added items is returned
+func mergeResults(results, page []Result) ([]Result, int) {
+	seen := make(map[string]bool, len(results)+len(page))
+	for i := range results {
+		id, url := results[i].getKeys()
+		seen[id], seen[url] = true, true
+	}
+
+	var added int
+	for i := range page {
+		id, url := page[i].getKeys()
+		if (id != "" && seen[id]) || (url != "" && seen[url]) {
+			continue
+		}
+		seen[id], seen[url] = true, true
+		results = append(results, page[i])
+		added++
+	}
+	return results, added
+}
+
+// dedupe removes repeated items from the page, batch count
+// is lowered by number of removed items
+func (res *DiscoverResult) dedupe() {
+	results, added := mergeResults(nil, res.Results)
+	removed := uint64(len(res.Results) - added)
+	res.Results = results
+
+	if removed > res.BatchResultCount {
+		res.BatchResultCount = 0
+	} else {
+		res.BatchResultCount -= removed
+	}
+}
+
 func (res DiscoverResult) String() string {
 	return marshalToString(&res)
 }
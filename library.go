@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// libraryItem is a saved album or track page, or home page of
+// artist or label, kind is only set for the latter
+type libraryItem struct {
+	URL    string    `json:"url"`
+	ArtID  uint64    `json:"art_id"`
+	Title  string    `json:"title"`
+	Artist string    `json:"artist"`
+	Tags   string    `json:"tags,omitempty"`
+	Kind   string    `json:"kind,omitempty"`
+	Added  time.Time `json:"added"`
+}
+
+// matches checks that every word is in title, artist or tags,
+// words must be lower case
+func (item *libraryItem) matches(words []string) bool {
+	text := strings.ToLower(item.Title + " " + item.Artist + " " + item.Tags)
+	for _, word := range words {
+		if !strings.Contains(text, word) {
+			return false
+		}
+	}
+	return true
+}
+
+// libraryStore keeps saved items, whole library is rewritten
+// on every change
+type libraryStore struct {
+	sync.Mutex
+	path  string
+	items []libraryItem
+}
+
+func getLibraryPath() (string, error) {
+	dir, err := getDataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "library.json"), nil
+}
+
+// newLibrary reads saved items, library still works in memory
+// if file can't be read
+func newLibrary() (*libraryStore, error) {
+	l := &libraryStore{}
+
+	path, err := getLibraryPath()
+	if err != nil {
+		return l, err
+	}
+	l.path = path
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return l, nil
+	} else if err != nil {
+		return l, err
+	}
+	return l, json.Unmarshal(data, &l.items)
+}
+
+// must be called with lock held
+func (l *libraryStore) find(url string) int {
+	for i, item := range l.items {
+		if item.URL == url {
+			return i
+		}
+	}
+	return -1
+}
+
+// toggle saves item or removes it, if it was already saved
+func (l *libraryStore) toggle(item libraryItem) (added bool, err error) {
+	l.Lock()
+	defer l.Unlock()
+
+	if i := l.find(item.URL); i >= 0 {
+		l.items = append(l.items[:i], l.items[i+1:]...)
+		return false, l.save()
+	}
+
+	if item.Added.IsZero() {
+		item.Added = time.Now()
+	}
+	l.items = append(l.items, item)
+	return true, l.save()
+}
+
+func (l *libraryStore) remove(url string) error {
+	l.Lock()
+	defer l.Unlock()
+
+	if i := l.find(url); i >= 0 {
+		l.items = append(l.items[:i], l.items[i+1:]...)
+		return l.save()
+	}
+	return nil
+}
+
+// list returns items that match filter, latest saved go first
+func (l *libraryStore) list(filter string) []libraryItem {
+	l.Lock()
+	defer l.Unlock()
+
+	words := strings.Fields(strings.ToLower(filter))
+	items := make([]libraryItem, 0, len(l.items))
+	for i := len(l.items) - 1; i >= 0; i-- {
+		if l.items[i].matches(words) {
+			items = append(items, l.items[i])
+		}
+	}
+	return items
+}
+
+// must be called with lock held
+func (l *libraryStore) save() error {
+	if l.path == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(l.items, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	// same as cache, file is never partially written
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.path)
+}
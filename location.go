@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// same lookup as location picker on discover page
+const geonameSearchURL = "https://bandcamp.com/api/location/1/geoname_search"
+
+type geoname struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	FullName string `json:"fullname"`
+}
+
+type geonameResponse struct {
+	OK      bool      `json:"ok"`
+	Results []geoname `json:"results"`
+}
+
+// locationCache keeps places found for location names, names are
+// looked up only once, cache is kept until removed by user
+type locationCache struct {
+	sync.Mutex
+	path   string
+	places map[string][]geoname
+}
+
+func getLocationCachePath() string {
+	dir := getCacheDir("")
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "locations.json")
+}
+
+// newLocationCache reads previous lookups, cache still works
+// in memory if file can't be read
+func newLocationCache() (*locationCache, error) {
+	c := &locationCache{
+		path:   getLocationCachePath(),
+		places: make(map[string][]geoname),
+	}
+	if c.path == "" {
+		return c, nil
+	}
+
+	data, err := os.ReadFile(c.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	} else if err != nil {
+		return c, err
+	}
+	return c, json.Unmarshal(data, &c.places)
+}
+
+// lower case, without extra spaces, both "Berlin" and "berlin " are the same
+func getLocationKey(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// find returns places that match location name, only lookups
+// that found anything are cached
+func (c *locationCache) find(ctx context.Context, name string) ([]geoname, error) {
+	key := getLocationKey(name)
+
+	c.Lock()
+	places, ok := c.places[key]
+	c.Unlock()
+	if ok {
+		return places, nil
+	}
+
+	places, err := makeGeonameRequest(ctx, key)
+	if err != nil || len(places) == 0 {
+		return places, err
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	c.places[key] = places
+	if err := c.save(); err != nil {
+		window.sendEvent(newDebugMessage("failed to save location cache: " +
+			err.Error()))
+	}
+	return places, nil
+}
+
+// must be called with lock held
+func (c *locationCache) save() error {
+	if c.path == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(c.places, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
+
+// pickLocation chooses place for location name, it's either the only
+// match, or the one with the same full or short name, false is returned
+// if user should choose one of the places
+func pickLocation(places []geoname, name string) (geoname, bool) {
+	if len(places) == 1 {
+		return places[0], true
+	}
+
+	key := getLocationKey(name)
+	for _, place := range places {
+		if getLocationKey(place.FullName) == key {
+			return place, true
+		}
+	}
+
+	var found []geoname
+	for _, place := range places {
+		if getLocationKey(place.Name) == key {
+			found = append(found, place)
+		}
+	}
+	if len(found) == 1 {
+		return found[0], true
+	}
+
+	return geoname{}, false
+}
+
+// resolveLocation finds geoname id of location from tag search
+// options, id can also be given directly, if several places match
+// they are sent for user to choose, 0 is returned in that case
+func resolveLocation(ctx context.Context, args arguments) (int64, error) {
+	name := strings.Join(args.location, " ")
+	if id, err := strconv.ParseInt(name, 10, 64); err == nil {
+		return id, nil
+	}
+
+	places, err := locations.find(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	if len(places) == 0 {
+		return 0, fmt.Errorf("location not found: %s", name)
+	}
+
+	place, ok := pickLocation(places, name)
+	if !ok {
+		window.sendEvent(newLocations(args, places))
+		return 0, nil
+	}
+
+	window.sendEvent(newMessage("location: " + place.FullName))
+	return place.ID, nil
+}
+
+func makeGeonameRequest(ctx context.Context, name string) ([]geoname, error) {
+	query := url.Values{}
+	query.Set("q", name)
+	query.Set("n", "10")
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		geonameSearchURL+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	r.Header.Set("Accept", "*/*")
+	r.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64; rv:120.0) Gecko/20100101 Firefox/120.0")
+
+	resp, err := client.Do(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("got unexpected response: %s\n%w", resp.Status, err)
+		}
+		return nil, fmt.Errorf("got unexpected response: %s\n%s", resp.Status, data)
+	}
+
+	var result geonameResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if !result.OK {
+		return nil, errors.New("location search failed")
+	}
+	return result.Results, nil
+}
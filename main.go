@@ -4,18 +4,27 @@ import (
 	"io"
 	"log"
 	"os"
+	"os/signal"
 	"runtime"
 	"runtime/pprof"
 	"sync"
+	"syscall"
 	"time"
 )
 
-var cache *FIFO
+var cache *LRU
+var images *imageCache
+var buffers *bufferList
+var downloads *downloadManager
 var player *streamPlayer
+var history *historyStore
+var library *libraryStore
+var locations *locationCache
 var wg sync.WaitGroup
 
 func init() {
-	cache = newCache(4)
+	buffers = newBufferList()
+	downloads = newDownloadManager()
 }
 
 func run(quit chan int) {
@@ -29,16 +38,40 @@ func run(quit chan int) {
 }
 
 func main() {
+	// client for already running instance
+	if len(os.Args) > 1 && os.Args[1] == "ctl" {
+		os.Exit(runClient(os.Args[2:]))
+	}
+	// export of listening history
+	if len(os.Args) > 1 && os.Args[1] == "history" {
+		os.Exit(runHistory(os.Args[2:]))
+	}
+
 	code, opt := readOptions()
 	if code >= 0 {
 		os.Exit(code)
 	}
 	defer opt.logFile.Close()
 
+	if opt.headless {
+		initHeadless()
+	} else if err := initScreen(); err != nil {
+		log.Printf("[err]: %v", err)
+		os.Exit(1)
+	}
+
+	// terminal is not required in headless mode,
+	// so it shouldn't stop when ssh session is closed
+	if opt.headless {
+		signal.Ignore(syscall.SIGHUP)
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
 	ticker := time.NewTicker(time.Second)
 	quit := make(chan int)
 	update := ticker.C
-	next := make(chan struct{})
+	next := make(chan bool)
 	text := make(chan interface{})
 
 	if opt.cpuProfile != "" {
@@ -54,21 +87,100 @@ func main() {
 		}
 	}
 
-	player = newPlayer(opt.sampleRate, text, next)
+	var err, imageErr error
+	cache, err = newCache(getCacheDir("audio"), opt.cacheSize*1024*1024)
+	images, imageErr = newImageCache(getCacheDir("images"))
+
+	player = newPlayer(opt.sampleRate, opt.crossfade, text, next)
+
+	var sessionErr error
+	if opt.restore {
+		window.session, sessionErr = loadSession()
+	}
+
+	var server *controlServer
+	var serverErr error
+	if opt.socket != "" {
+		server, serverErr = newControlServer(opt.socket)
+	}
+
+	var api *apiServer
+	var apiErr error
+	if opt.httpAddress != "" {
+		api, apiErr = newAPIServer(opt.httpAddress)
+	}
+
+	var scrobbles *scrobbler
+	var scrobbleErr error
+	if opt.scrobbleToken != "" {
+		scrobbles, scrobbleErr = newScrobbler(opt.scrobbleURL, opt.scrobbleToken)
+	}
+
+	var historyErr error
+	history, historyErr = newHistory()
+
+	var libraryErr error
+	library, libraryErr = newLibrary()
+
+	var locationsErr error
+	locations, locationsErr = newLocationCache()
+
+	var mpris *mprisServer
+	var mprisErr error
+	if opt.mpris {
+		mpris, mprisErr = newMprisServer()
+	}
 
 	// TODO: test if needed anymore
 	// window.recalculateBounds()
-	// TODO: remove wg.Add() from downloaders
-	// for now, let them finish gracefully
 	wg.Add(1)
-	go run(quit)
+	if opt.headless {
+		go runHeadless(quit)
+	} else {
+		go run(quit)
+	}
 
 	// NOTE: this will prevent logging to os.Stderr, while app is running
 	// FIXME: this should be reworked completely
-	if opt.logFile != nil {
-		log.Default().SetOutput(opt.logFile)
-	} else {
-		log.Default().SetOutput(io.Discard)
+	// nothing is drawn in headless mode, so log still goes to stderr
+	if !opt.headless {
+		if opt.logFile != nil {
+			log.Default().SetOutput(opt.logFile)
+		} else {
+			log.Default().SetOutput(io.Discard)
+		}
+	}
+
+	// cache still works without disk, but only in memory
+	if err != nil {
+		log.Printf("[err]: audio cache: %v", err)
+	}
+	if imageErr != nil {
+		log.Printf("[err]: image cache: %v", imageErr)
+	}
+	if sessionErr != nil {
+		log.Printf("[err]: session: %v", sessionErr)
+	}
+	if serverErr != nil {
+		log.Printf("[err]: control socket: %v", serverErr)
+	}
+	if mprisErr != nil {
+		log.Printf("[err]: mpris: %v", mprisErr)
+	}
+	if apiErr != nil {
+		log.Printf("[err]: http api: %v", apiErr)
+	}
+	if scrobbleErr != nil {
+		log.Printf("[err]: scrobbler: %v", scrobbleErr)
+	}
+	if historyErr != nil {
+		log.Printf("[err]: history: %v", historyErr)
+	}
+	if libraryErr != nil {
+		log.Printf("[err]: library: %v", libraryErr)
+	}
+	if locationsErr != nil {
+		log.Printf("[err]: location cache: %v", locationsErr)
 	}
 
 loop:
@@ -79,6 +191,10 @@ loop:
 			log.Println("[ext]: main loop exit")
 			break loop
 
+		case sig := <-signals:
+			log.Printf("[ext]: %v", sig)
+			quitApp()
+
 		case <-update:
 			window.sendEvent(&eventUpdate{})
 
@@ -91,8 +207,8 @@ loop:
 				window.sendEvent(newErrorMessage(text))
 			}
 
-		case <-next:
-			window.sendEvent(&eventNextTrack{})
+		case switched := <-next:
+			window.sendEvent(newNextTrack(switched))
 
 		default:
 			time.Sleep(50 * time.Millisecond)
@@ -100,6 +216,20 @@ loop:
 	}
 
 	ticker.Stop()
+	if server != nil {
+		server.Close()
+	}
+	if mpris != nil {
+		mpris.Close()
+	}
+	if api != nil {
+		api.Close()
+	}
+	if scrobbles != nil {
+		scrobbles.Close()
+	}
+	history.Close()
+	downloads.cancelAll()
 	wg.Wait()
 
 	// FIXME: this should be reworked
@@ -113,6 +243,12 @@ loop:
 		pprof.StopCPUProfile()
 	}
 
+	// player has to be still open to get its position
+	if err := saveSession(); err != nil {
+		log.Printf("[err]: session: %v", err)
+		code = 1
+	}
+
 	if err := player.Close(); err != nil {
 		log.Printf("[err]: %v", err)
 		code = 1
@@ -23,6 +23,10 @@ const (
 	playlistModel
 	helpModel
 	resultsModel
+	historyModel
+	libraryModel
+	releasesModel
+	locationsModel
 )
 
 type contentModel interface {
@@ -66,43 +70,43 @@ func (model *defaultModel) GetCell(x, y int) (rune, tcell.Style, []rune, int) {
 }
 
 func (model *defaultModel) update() {
-	if window.playlist == nil {
+	track := player.getCurrentTrack()
+	item, t := window.playlist.get(track)
+	if item == nil {
 		// NOTE: should not get to this point
 		return
 	}
-	track := player.getCurrentTrack()
 	timeStamp := player.getCurrentTrackPosition()
 	volume := player.getVolume()
 	model.endx, model.endy = window.getBounds()
-	repeats := progressbarLength(window.playlist.tracks[track].duration,
-		timeStamp, model.endx)
+	repeats := progressbarLength(t.duration, timeStamp, model.endx)
 
 	// if we are playing track from album and it is not single
 	// display from what album track actually comes
 	var from, title, album string
-	if !window.playlist.single && !window.playlist.album {
+	if !item.single && !item.album {
 		from = " from "
-		title = window.playlist.tracks[track].title
-		album = window.playlist.title
+		title = t.title
+		album = item.title
 	} else {
-		title = window.playlist.title
+		title = item.title
 	}
 
 	fmt.Fprintf(&model.sbuilder, model.formatString,
 		title,
 		from, album,
-		window.playlist.artist,
-		window.playlist.date,
-		window.playlist.tags,
+		item.artist,
+		item.date,
+		item.tags,
 		window.getPlayerStatus(),
 		track+1,
-		window.playlist.totalTracks,
-		window.playlist.tracks[track].title,
+		window.playlist.len(),
+		t.title,
 		strings.Repeat(window.getProgressbarSymbol(), repeats),
 		timeStamp,
-		(time.Duration(window.playlist.tracks[track].duration) * time.Second).Round(time.Second),
-		volume, player.playbackMode,
-		window.playlist.url,
+		(time.Duration(t.duration) * time.Second).Round(time.Second),
+		volume, player.playbackMode, player.getCrossfade(),
+		item.url,
 	)
 
 	text := model.sbuilder.String()
@@ -252,15 +256,15 @@ func (model *textModel) GetCell(x, y int) (rune, tcell.Style, []rune, int) {
 }
 
 func (model *textModel) create() {
-	if window.playlist == nil {
+	item, t := window.playlist.get(player.currentTrack)
+	if item == nil {
 		// NOTE: should not get to this point
 		return
 	}
 
-	track := player.currentTrack
 	var from string
 
-	if window.playlist.tracks[track].lyrics == "" {
+	if t.lyrics == "" {
 		model.text = make([][]rune, 1)
 		model.text[0] = append(model.text[0], '\ue000', 'n', 'o', ' ',
 			'l', 'y', 'r', 'i', 'c', 's', ' ', 'f', 'o', 'u', 'n', 'd',
@@ -270,13 +274,13 @@ func (model *textModel) create() {
 		return
 	}
 
-	if !window.playlist.single {
-		from = " from \ue000" + window.playlist.title + "\ue001"
+	if !item.single {
+		from = " from \ue000" + item.title + "\ue001"
 	}
 
-	text := fmt.Sprint(window.playlist.tracks[track].title, "\n",
-		from, " by \ue000", window.playlist.artist, "\ue001\n\n",
-		window.playlist.tracks[track].lyrics)
+	text := fmt.Sprint(t.title, "\n",
+		from, " by \ue000", item.artist, "\ue001\n\n",
+		t.lyrics)
 	model.text = make([][]rune, strings.Count(text, "\n")+1)
 
 	model.endx, model.endy = generateCharMatrix(text, model.text)
@@ -424,31 +428,33 @@ func (model *menuModel) update() {
 	//    3 - title
 	//
 	//    0m0s
-	if window.playlist == nil {
+	// tracks that come from the same album one after another
+	// are grouped, album is shown only for the first one,
+	// or the second one, if first is active
+	if window.playlist.isEmpty() {
 		// NOTE: should not get to this point
 		return
 	}
 	// FIXME: direct acces to player data
-	track := player.currentTrack
-
-	model.activeItem = track
-	model.totalItems = window.playlist.totalTracks
+	model.activeItem = player.currentTrack
+	model.totalItems = window.playlist.len()
 	timeStamp := player.getCurrentTrackPosition()
-	repeats := progressbarLength(window.playlist.tracks[model.activeItem].duration,
+	repeats := progressbarLength(window.getTrackDuration(model.activeItem),
 		timeStamp, model.endx)
 
-	for n, track := range window.playlist.tracks {
+	for n := 0; n < window.playlist.len(); n++ {
+		item, track := window.playlist.get(n)
 		// FIXME: this is just bad
 		if n == model.activeItem {
 			fmt.Fprintf(&model.sbuilder, model.formatString[0],
 				window.getPlayerStatus(),
-				n+1,
+				track.trackNumber,
 				track.title,
 			)
 		} else {
 			fmt.Fprintf(&model.sbuilder, model.formatString[0],
 				"  ",
-				n+1,
+				track.trackNumber,
 				track.title,
 			)
 		}
@@ -457,6 +463,9 @@ func (model *menuModel) update() {
 			fmt.Fprintf(&model.sbuilder, model.formatString[1],
 				strings.Repeat(window.getProgressbarSymbol(), repeats),
 				"", "", "", "", "", "", "")
+		} else if window.playlist.sameItem(n-1, n) && n-1 != model.activeItem {
+			fmt.Fprintf(&model.sbuilder, model.formatString[1],
+				"", "", "", "", "", "", "", "")
 		} else {
 			var styleStart, styleEnd string
 			if n != model.item {
@@ -464,14 +473,14 @@ func (model *menuModel) update() {
 				styleEnd = "\ue001"
 			}
 
-			if window.playlist.single {
+			if item.single {
 				fmt.Fprintf(&model.sbuilder, model.formatString[1],
-					"     by ", styleStart, window.playlist.artist, styleEnd,
+					"     by ", styleStart, item.artist, styleEnd,
 					"", "", "", "")
 			} else {
 				fmt.Fprintf(&model.sbuilder, model.formatString[1],
-					"     from ", styleStart, window.playlist.title, styleEnd,
-					" by ", styleStart, window.playlist.artist, styleEnd,
+					"     from ", styleStart, item.title, styleEnd,
+					" by ", styleStart, item.artist, styleEnd,
 				)
 			}
 		}
@@ -525,9 +534,6 @@ type searchResultsModel struct {
 	*menuModel
 }
 
-// TODO?: on certain circumstances there are several
-// entries of the same item (exactly the same, and not
-// album published by label/etc.)
 // FIXME: will crash on empty results but there's no way
 // to set this view with empty results?
 func (model *searchResultsModel) create() {
@@ -557,10 +563,10 @@ func (model *searchResultsModel) create() {
 func (model *searchResultsModel) update() {
 	// ▹  active title
 	//     by %artist%
-	//    %track_count%, track(s) %duration%
+	//    album, %track_count% track(s), %duration%
 	//    title
 	//     by %artist%
-	//    %track_count%, track(s) %duration%
+	//    track, %duration%
 	for i, item := range window.searchResults.Results {
 
 		var by, artist, styleStart, styleEnd, playerStatus string
@@ -568,24 +574,22 @@ func (model *searchResultsModel) update() {
 			by = "by"
 		}
 
-		if i != model.item && i != model.activeItem {
-			styleStart, styleEnd = "\ue000", "\ue001"
-		}
+		styleStart, styleEnd = getResultStyle(i, model.item, model.activeItem)
 		if i == model.activeItem {
 			playerStatus = window.getPlayerStatus()
 		}
 
-		if item.AlbumArtist != nil {
-			artist = *item.AlbumArtist
-		} else {
-			artist = item.BandName
-		}
+		artist = item.getArtist()
 
-		fmt.Fprintf(&model.sbuilder, "%2s  %s\n     %s %s%s%s\n",
-			playerStatus, item.Title,
-			by, styleStart, artist, styleEnd)
+		writeResultTitle(&model.sbuilder, playerStatus, item.Title,
+			by, styleStart+artist+styleEnd)
 
-		if item.TrackCount > 0 {
+		switch {
+		case item.ResultType == "t":
+			fmt.Fprintf(&model.sbuilder, "    track, %s%0.f%s minutes",
+				styleStart, math.Round(item.getDuration()/60.0), styleEnd)
+
+		case item.TrackCount > 0:
 			var tracks string
 			if item.TrackCount == 1 {
 				tracks = "track"
@@ -593,9 +597,17 @@ func (model *searchResultsModel) update() {
 				tracks = "tracks"
 			}
 
-			fmt.Fprintf(&model.sbuilder, "    %s%d%s %s, %s%0.f%s minutes",
+			fmt.Fprintf(&model.sbuilder, "    album, %s%d%s %s, %s%0.f%s minutes",
 				styleStart, item.TrackCount, styleEnd, tracks,
 				styleStart, math.Round(item.Duration/60.0), styleEnd)
+
+		default:
+			model.sbuilder.WriteString("    album")
+		}
+
+		if i == model.activeItem && window.isPreview() {
+			fmt.Fprintf(&model.sbuilder, ", preview of \ue000%s\ue001",
+				item.FeaturedTrack.Title)
 		}
 
 		model.sbuilder.WriteByte('\n')
@@ -613,6 +625,20 @@ func (model *searchResultsModel) update() {
 	model.endy = len(model.text)
 }
 
+// items that are not selected or active are drawn with accent
+func getResultStyle(item, selected, active int) (string, string) {
+	if item != selected && item != active {
+		return "\ue000", "\ue001"
+	}
+	return "", ""
+}
+
+// writeResultTitle writes first two lines of the result list item,
+// third one is up to the list
+func writeResultTitle(sb *strings.Builder, status, title, by, artist string) {
+	fmt.Fprintf(sb, "%2s  %s\n     %s %s\n", status, title, by, artist)
+}
+
 func (model *searchResultsModel) MoveCursor(offx, offy int) {
 	prevPos := model.getItem()
 	model.menuModel.MoveCursor(offx, offy)
@@ -640,20 +666,311 @@ func (model *searchResultsModel) triggerNewDownload(currPos, offy int) {
 			window.sendEvent(newMessage("nothing else to show"))
 		} else if !window.waiting {
 			window.waiting = true
-			wg.Add(1)
 			window.searchResults.Request.Cursor = *window.searchResults.Cursor
-			go getAdditionalResults(window.searchResults.Request)
+			downloads.additional(window.searchResults.Request)
 		}
 	}
 
-	artID := window.searchResults.Results[currPos].PrimaryImage.ImageId
-	url := window.getImageURL(artID)
-	if url == "" {
-		window.sendEvent(newCoverDownloaded(nil, ""))
-		window.coverKey = ""
-		return
+	window.loadCover(window.searchResults.Results[currPos].PrimaryImage.ImageId)
+}
+
+// historyListModel shows recent plays, latest first,
+// list is only updated when view is opened
+type historyListModel struct {
+	*menuModel
+	entries []historyEntry
+}
+
+func (model *historyListModel) create() {
+	model.entries = history.recent()
+	model.x, model.y, model.item = 0, 0, 0
+	model.onBottom = false
+	model.update()
+}
+
+func (model *historyListModel) update() {
+	//    title
+	//     by %artist%, from %album%
+	//    %time%, listened %listened% (skipped)
+	if len(model.entries) == 0 {
+		model.sbuilder.WriteString("\n    \ue000no plays yet\ue001\n")
+	}
+
+	for i, entry := range model.entries {
+		var styleStart, styleEnd, skipped string
+		if i != model.item {
+			styleStart, styleEnd = "\ue000", "\ue001"
+		}
+		if entry.Skipped {
+			skipped = ", skipped"
+		}
+
+		fmt.Fprintf(&model.sbuilder, "    %s\n     by %s%s%s, from %s%s%s\n"+
+			"    %s%s%s, listened %s%s\n",
+			entry.Title,
+			styleStart, entry.Artist, styleEnd,
+			styleStart, entry.Album, styleEnd,
+			styleStart, entry.Time.Local().Format("2006-01-02 15:04"), styleEnd,
+			time.Duration(entry.Listened)*time.Second, skipped)
+	}
+	model.totalItems = len(model.entries)
+
+	text := model.sbuilder.String()
+	model.sbuilder.Reset()
+
+	model.text = make([][]rune, strings.Count(text, "\n"))
+	generateCharMatrix(text, model.text)
+
+	model.endx, _ = window.getBounds()
+	model.endy = len(model.text)
+}
+
+// getURL returns url of the album or track of selected entry
+func (model *historyListModel) getURL() string {
+	item := model.getItem()
+	if item >= len(model.entries) {
+		return ""
+	}
+	return model.entries[item].URL
+}
+
+// libraryListModel shows saved items, latest first, filter
+// is kept until it's changed from input
+type libraryListModel struct {
+	*menuModel
+	filter string
+	items  []libraryItem
+}
+
+func (model *libraryListModel) create() {
+	model.items = library.list(model.filter)
+	model.x, model.y, model.item = 0, 0, 0
+	model.onBottom = false
+	model.update()
+	model.loadCover()
+}
+
+func (model *libraryListModel) update() {
+	//    title
+	//     by %artist%
+	//    %tags%
+	if len(model.items) == 0 && model.filter != "" {
+		fmt.Fprintf(&model.sbuilder, "\n    \ue000nothing matches \"%s\"\ue001\n",
+			model.filter)
+	} else if len(model.items) == 0 {
+		model.sbuilder.WriteString("\n    \ue000library is empty\ue001\n")
+	}
+
+	for i, item := range model.items {
+		var styleStart, styleEnd string
+		if i != model.item {
+			styleStart, styleEnd = "\ue000", "\ue001"
+		}
+
+		// artists and labels have only kind
+		by, artist := "by ", item.Artist
+		if item.Kind != "" {
+			by, artist = "", item.Kind
+		}
+
+		fmt.Fprintf(&model.sbuilder, "    %s\n     %s%s%s%s\n    %s%s%s\n",
+			item.Title,
+			by, styleStart, artist, styleEnd,
+			styleStart, item.Tags, styleEnd)
+	}
+	model.totalItems = len(model.items)
+
+	text := model.sbuilder.String()
+	model.sbuilder.Reset()
+
+	model.text = make([][]rune, strings.Count(text, "\n"))
+	generateCharMatrix(text, model.text)
+
+	model.endx, _ = window.getBounds()
+	model.endy = len(model.text)
+}
+
+func (model *libraryListModel) MoveCursor(offx, offy int) {
+	prevPos := model.getItem()
+	model.menuModel.MoveCursor(offx, offy)
+	if model.getItem() != prevPos {
+		model.loadCover()
+	}
+}
+
+func (model *libraryListModel) SetCursor(x, y int) {
+	model.menuModel.SetCursor(x, y)
+	model.loadCover()
+}
+
+// loadCover shows art of selected item, same as search results
+func (model *libraryListModel) loadCover() {
+	if item := model.getItem(); item < len(model.items) {
+		window.loadCover(model.items[item].ArtID)
+	}
+}
+
+// getURL returns url of selected item
+func (model *libraryListModel) getURL() string {
+	saved, _ := model.getSaved()
+	return saved.URL
+}
+
+func (model *libraryListModel) getSaved() (libraryItem, bool) {
+	item := model.getItem()
+	if item >= len(model.items) {
+		return libraryItem{}, false
+	}
+	return model.items[item], true
+}
+
+// releaseListModel shows artist discography, label roster
+// or site search results, same as tag search results
+type releaseListModel struct {
+	*menuModel
+	roster bool
+}
+
+// items returns list that is displayed right now
+func (model *releaseListModel) items() []release {
+	if window.releases == nil {
+		return nil
+	}
+	if model.roster {
+		return window.releases.roster
+	}
+	return window.releases.releases
+}
+
+func (model *releaseListModel) create() {
+	model.activeItem = -1
+	url := window.getItemURL()
+	for i, item := range model.items() {
+		if url != "" && item.url == url {
+			model.activeItem = i
+			break
+		}
+	}
+
+	model.update()
+}
+
+func (model *releaseListModel) update() {
+	// ▹  active title
+	//     by %artist%
+	//    %kind%
+	//    artist
+	//     from %location%
+	//    artist
+	items := model.items()
+	for i, item := range items {
+		var playerStatus string
+		styleStart, styleEnd := getResultStyle(i, model.item, model.activeItem)
+		if i == model.activeItem {
+			playerStatus = window.getPlayerStatus()
+		}
+
+		by := "by"
+		if !item.isMedia() && item.artist != "" {
+			by = "from"
+		} else if !item.isMedia() {
+			by = ""
+		}
+
+		writeResultTitle(&model.sbuilder, playerStatus, item.title,
+			by, styleStart+item.artist+styleEnd)
+		fmt.Fprintf(&model.sbuilder, "    %s%s%s\n", styleStart, item.kind, styleEnd)
+	}
+	model.totalItems = len(items)
+
+	text := model.sbuilder.String()
+	model.sbuilder.Reset()
+
+	model.text = make([][]rune, strings.Count(text, "\n"))
+	generateCharMatrix(text, model.text)
+
+	model.endx, _ = window.getBounds()
+	model.endy = len(model.text)
+}
+
+func (model *releaseListModel) MoveCursor(offx, offy int) {
+	prevPos := model.getItem()
+	model.menuModel.MoveCursor(offx, offy)
+	if model.getItem() != prevPos {
+		model.loadCover()
+	}
+}
+
+func (model *releaseListModel) SetCursor(x, y int) {
+	model.menuModel.SetCursor(x, y)
+	model.loadCover()
+}
+
+func (model *releaseListModel) loadCover() {
+	if items, item := model.items(), model.getItem(); item < len(items) {
+		window.loadCover(items[item].artID)
+	}
+}
+
+// getRelease returns selected release or artist
+func (model *releaseListModel) getRelease() (release, bool) {
+	items, item := model.items(), model.getItem()
+	if item >= len(items) {
+		return release{}, false
+	}
+	return items[item], true
+}
+
+// toggleRoster switches between label releases and roster
+func (model *releaseListModel) toggleRoster() bool {
+	if window.releases == nil || !window.releases.label {
+		return false
+	}
+	model.roster = !model.roster
+	model.x, model.y, model.item = 0, 0, 0
+	model.onBottom = false
+	return true
+}
+
+// locationListModel shows places that match location of tag search
+type locationListModel struct {
+	*menuModel
+	args   arguments
+	places []geoname
+}
+
+func (model *locationListModel) create() {
+	model.update()
+}
+
+func (model *locationListModel) update() {
+	//    full name
+	//     geoname id %id%
+	//
+	for i, place := range model.places {
+		styleStart, styleEnd := getResultStyle(i, model.item, model.activeItem)
+		fmt.Fprintf(&model.sbuilder, "    %s\n     %sgeoname id %d%s\n\n",
+			place.FullName, styleStart, place.ID, styleEnd)
+	}
+	model.totalItems = len(model.places)
+
+	text := model.sbuilder.String()
+	model.sbuilder.Reset()
+
+	model.text = make([][]rune, strings.Count(text, "\n"))
+	generateCharMatrix(text, model.text)
+
+	model.endx, _ = window.getBounds()
+	model.endy = len(model.text)
+}
+
+// getArgs returns search options with selected place
+func (model *locationListModel) getArgs() (arguments, bool) {
+	item := model.getItem()
+	if item >= len(model.places) {
+		return arguments{}, false
 	}
-	window.coverKey = window.getImageURL(artID)
-	wg.Add(1)
-	go downloadCover(window.coverKey)
+	args := model.args
+	args.geonameID = model.places[item].ID
+	return args, true
 }
@@ -0,0 +1,356 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"github.com/godbus/dbus/v5/prop"
+)
+
+// https://specifications.freedesktop.org/mpris-spec/latest/
+const (
+	mprisName            = "org.mpris.MediaPlayer2.gobandcamp"
+	mprisPath            = "/org/mpris/MediaPlayer2"
+	mprisRootInterface   = "org.mpris.MediaPlayer2"
+	mprisPlayerInterface = "org.mpris.MediaPlayer2.Player"
+	mprisNoTrack         = "/org/mpris/MediaPlayer2/TrackList/NoTrack"
+	mprisTrackPath       = "/com/github/olde_ducke/gobandcamp/track/"
+)
+
+const mprisAvailable = true
+
+// mprisServer exposes player on the session bus, so it can be
+// controlled with media keys, desktop widgets and playerctl
+type mprisServer struct {
+	conn  *dbus.Conn
+	props *prop.Properties
+	state chan playerState
+	last  playerState
+}
+
+// methods of org.mpris.MediaPlayer2
+type mprisRoot struct{}
+
+// methods of org.mpris.MediaPlayer2.Player
+type mprisPlayer struct {
+	server *mprisServer
+}
+
+// Seek can't be used as a method name, go vet expects io.Seeker
+var mprisPlayerMethods = map[string]string{"SeekBy": "Seek"}
+
+func newMprisServer() (*mprisServer, error) {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return nil, err
+	}
+
+	server := &mprisServer{conn: conn}
+	if err := server.export(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	reply, err := conn.RequestName(mprisName, dbus.NameFlagDoNotQueue)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// name is taken by other instance, spec allows unique suffix
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		name := fmt.Sprintf("%s.instance%d", mprisName, os.Getpid())
+		if _, err := conn.RequestName(name, dbus.NameFlagDoNotQueue); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	server.state = watchers.subscribe()
+	go server.watch()
+	return server, nil
+}
+
+func (server *mprisServer) export() error {
+	err := server.conn.Export(mprisRoot{}, mprisPath, mprisRootInterface)
+	if err != nil {
+		return err
+	}
+
+	err = server.conn.ExportWithMap(&mprisPlayer{server: server},
+		mprisPlayerMethods, mprisPath, mprisPlayerInterface)
+	if err != nil {
+		return err
+	}
+
+	server.props, err = prop.Export(server.conn, mprisPath, prop.Map{
+		mprisRootInterface: {
+			"CanQuit":             {Value: true, Emit: prop.EmitConst},
+			"CanRaise":            {Value: false, Emit: prop.EmitConst},
+			"HasTrackList":        {Value: false, Emit: prop.EmitConst},
+			"Identity":            {Value: "gobandcamp", Emit: prop.EmitConst},
+			"SupportedUriSchemes": {Value: []string{"http", "https"}, Emit: prop.EmitConst},
+			"SupportedMimeTypes":  {Value: []string{}, Emit: prop.EmitConst},
+		},
+		mprisPlayerInterface: {
+			"PlaybackStatus": {Value: "Stopped", Emit: prop.EmitTrue},
+			"Rate":           {Value: 1.0, Emit: prop.EmitConst},
+			"MinimumRate":    {Value: 1.0, Emit: prop.EmitConst},
+			"MaximumRate":    {Value: 1.0, Emit: prop.EmitConst},
+			"Metadata":       {Value: getMprisMetadata(playerState{}), Emit: prop.EmitTrue},
+			"Volume": {Value: 1.0, Emit: prop.EmitTrue, Writable: true,
+				Callback: setMprisVolume},
+			"Position":      {Value: int64(0), Emit: prop.EmitFalse},
+			"CanGoNext":     {Value: false, Emit: prop.EmitTrue},
+			"CanGoPrevious": {Value: false, Emit: prop.EmitTrue},
+			"CanPlay":       {Value: false, Emit: prop.EmitTrue},
+			"CanPause":      {Value: false, Emit: prop.EmitTrue},
+			"CanSeek":       {Value: false, Emit: prop.EmitTrue},
+			"CanControl":    {Value: true, Emit: prop.EmitConst},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	node := &introspect.Node{
+		Name: mprisPath,
+		Interfaces: []introspect.Interface{
+			introspect.IntrospectData,
+			prop.IntrospectData,
+			{
+				Name:       mprisRootInterface,
+				Methods:    introspect.Methods(mprisRoot{}),
+				Properties: server.props.Introspection(mprisRootInterface),
+			},
+			{
+				Name:       mprisPlayerInterface,
+				Methods:    getMprisPlayerMethods(),
+				Properties: server.props.Introspection(mprisPlayerInterface),
+				Signals: []introspect.Signal{{
+					Name: "Seeked",
+					Args: []introspect.Arg{{Name: "Position", Type: "x"}},
+				}},
+			},
+		},
+	}
+
+	return server.conn.Export(introspect.NewIntrospectable(node), mprisPath,
+		"org.freedesktop.DBus.Introspectable")
+}
+
+func getMprisPlayerMethods() []introspect.Method {
+	methods := introspect.Methods(&mprisPlayer{})
+	for i := range methods {
+		if name, ok := mprisPlayerMethods[methods[i].Name]; ok {
+			methods[i].Name = name
+		}
+	}
+	return methods
+}
+
+// watch updates properties, until server is closed
+func (server *mprisServer) watch() {
+	for state := range server.state {
+		server.update(state)
+	}
+}
+
+// update sets only changed properties, so there are no excessive signals
+func (server *mprisServer) update(state playerState) {
+	last := server.last
+	server.last = state
+
+	server.props.SetMust(mprisPlayerInterface, "Position",
+		toMicroseconds(state.Position))
+
+	if state.Status != last.Status {
+		server.props.SetMust(mprisPlayerInterface, "PlaybackStatus",
+			getMprisStatus(state.Status))
+	}
+
+	if state.Volume != last.Volume || state.Muted != last.Muted {
+		server.props.SetMust(mprisPlayerInterface, "Volume",
+			getMprisVolume(state))
+	}
+
+	if state.Track != last.Track || state.URL != last.URL ||
+		state.Title != last.Title || state.Duration != last.Duration ||
+		state.ArtURL != last.ArtURL {
+		server.props.SetMust(mprisPlayerInterface, "Metadata",
+			getMprisMetadata(state))
+	}
+
+	if hasTracks := state.Tracks > 0; hasTracks != (last.Tracks > 0) {
+		for _, name := range []string{"CanGoNext", "CanGoPrevious",
+			"CanPlay", "CanPause", "CanSeek"} {
+			server.props.SetMust(mprisPlayerInterface, name, hasTracks)
+		}
+	}
+}
+
+func (server *mprisServer) Close() error {
+	if server.state != nil {
+		watchers.unsubscribe(server.state)
+	}
+	return server.conn.Close()
+}
+
+func toMicroseconds(seconds float64) int64 {
+	return int64(math.Round(seconds * 1e6))
+}
+
+func getMprisStatus(status string) string {
+	switch status {
+	case "playing":
+		return "Playing"
+	case "paused":
+		return "Paused"
+	default:
+		return "Stopped"
+	}
+}
+
+func getMprisVolume(state playerState) float64 {
+	if state.Muted {
+		return 0.0
+	}
+	return float64(state.Volume) / 100
+}
+
+// track id is a position in the queue
+func getMprisTrackID(track int) dbus.ObjectPath {
+	if track <= 0 {
+		return mprisNoTrack
+	}
+	return dbus.ObjectPath(fmt.Sprintf("%s%d", mprisTrackPath, track))
+}
+
+func getMprisMetadata(state playerState) map[string]dbus.Variant {
+	metadata := map[string]dbus.Variant{
+		"mpris:trackid": dbus.MakeVariant(getMprisTrackID(state.Track)),
+	}
+	if state.Track <= 0 {
+		return metadata
+	}
+
+	metadata["mpris:length"] = dbus.MakeVariant(toMicroseconds(state.Duration))
+	metadata["xesam:title"] = dbus.MakeVariant(state.Title)
+	metadata["xesam:album"] = dbus.MakeVariant(state.Album)
+	metadata["xesam:url"] = dbus.MakeVariant(state.URL)
+	if state.Artist != "" {
+		metadata["xesam:artist"] = dbus.MakeVariant([]string{state.Artist})
+		metadata["xesam:albumArtist"] = dbus.MakeVariant([]string{state.Artist})
+	}
+	if state.ArtURL != "" {
+		metadata["mpris:artUrl"] = dbus.MakeVariant(state.ArtURL)
+	}
+	return metadata
+}
+
+// volume is changed by setting property
+func setMprisVolume(change *prop.Change) *dbus.Error {
+	volume, ok := change.Value.(float64)
+	if !ok {
+		return prop.ErrInvalidArg
+	}
+	_, err := mprisCommand("volume", fmt.Sprintf("%.0f", math.Max(volume, 0)*100))
+	return err
+}
+
+// mprisCommand runs command in the event loop, same as control socket
+func mprisCommand(name string, args ...string) (*playerState, *dbus.Error) {
+	reply := sendCommand(command{Name: name, Args: args})
+	if !reply.OK {
+		return nil, dbus.MakeFailedError(errors.New(reply.Error))
+	}
+	return reply.Status, nil
+}
+
+func (mprisRoot) Raise() *dbus.Error {
+	return nil
+}
+
+func (mprisRoot) Quit() *dbus.Error {
+	_, err := mprisCommand("quit")
+	return err
+}
+
+func (p *mprisPlayer) Next() *dbus.Error {
+	_, err := mprisCommand("next")
+	return err
+}
+
+func (p *mprisPlayer) Previous() *dbus.Error {
+	_, err := mprisCommand("prev")
+	return err
+}
+
+func (p *mprisPlayer) Pause() *dbus.Error {
+	_, err := mprisCommand("pause")
+	return err
+}
+
+func (p *mprisPlayer) PlayPause() *dbus.Error {
+	_, err := mprisCommand("toggle")
+	return err
+}
+
+func (p *mprisPlayer) Stop() *dbus.Error {
+	_, err := mprisCommand("stop")
+	return err
+}
+
+func (p *mprisPlayer) Play() *dbus.Error {
+	_, err := mprisCommand("play")
+	return err
+}
+
+// SeekBy moves position relative to the current one
+func (p *mprisPlayer) SeekBy(offset int64) *dbus.Error {
+	state, err := mprisCommand("seek", fmt.Sprintf("%+f", float64(offset)/1e6))
+	if err != nil {
+		return err
+	}
+	return p.seeked(state)
+}
+
+// SetPosition is ignored if track is not current anymore
+func (p *mprisPlayer) SetPosition(trackID dbus.ObjectPath, position int64) *dbus.Error {
+	state, err := mprisCommand("status")
+	if err != nil {
+		return err
+	}
+
+	if trackID != getMprisTrackID(state.Track) || position < 0 ||
+		position > toMicroseconds(state.Duration) {
+		return nil
+	}
+
+	state, err = mprisCommand("seek", fmt.Sprintf("%f", float64(position)/1e6))
+	if err != nil {
+		return err
+	}
+	return p.seeked(state)
+}
+
+func (p *mprisPlayer) OpenUri(uri string) *dbus.Error {
+	_, err := mprisCommand("open", uri)
+	return err
+}
+
+func (p *mprisPlayer) seeked(state *playerState) *dbus.Error {
+	position := toMicroseconds(state.Position)
+	p.server.props.SetMust(mprisPlayerInterface, "Position", position)
+	err := p.server.conn.Emit(mprisPath, mprisPlayerInterface+".Seeked", position)
+	if err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package main
+
+// MPRIS is only available on linux
+const mprisAvailable = false
+
+type mprisServer struct{}
+
+func newMprisServer() (*mprisServer, error) {
+	return nil, nil
+}
+
+func (server *mprisServer) Close() error {
+	return nil
+}
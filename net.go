@@ -1,10 +1,10 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
 	"compress/flate"
 	"compress/gzip"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -13,21 +13,22 @@ import (
 	"image/png"
 	"io"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 )
 
 var client = http.Client{Timeout: 120 * time.Second}
 
-// TODO: cancel response body readings for unfinished tracks
-// will solve a lot of problems
 // TODO: maybe it is a good idea to check domain everytime, just in case?
-func download(link string, mobile bool, checkDomain bool) (io.ReadCloser, string) {
+// download returns body of response with its content type and
+// size, size is -1 if unknown
+func download(ctx context.Context, link string, mobile bool, checkDomain bool) (io.ReadCloser, string, int64) {
 	window.sendEvent(newDebugMessage(link))
-	request, err := http.NewRequest("GET", link, nil)
+	request, err := http.NewRequestWithContext(ctx, "GET", link, nil)
 	if err != nil {
 		window.sendEvent(newErrorMessage(err))
-		return nil, ""
+		return nil, "", 0
 	}
 	// pretend that we are Chrome on Win10
 	request.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 12_0_1) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/95.0.4638.69 Safari/537.36")
@@ -37,6 +38,14 @@ func download(link string, mobile bool, checkDomain bool) (io.ReadCloser, string
 	}
 
 	response, err := client.Do(request)
+	if ctx.Err() != nil {
+		// download was cancelled, nobody waits for it
+		if err == nil {
+			response.Body.Close()
+		}
+		return nil, "", 0
+	}
+
 	if err != nil {
 		// https requests fail here because reasons (real certificate
 		// is replacced by expired generic one), only relevant for
@@ -44,11 +53,11 @@ func download(link string, mobile bool, checkDomain bool) (io.ReadCloser, string
 		// basically try http instead of https, and don't report error
 		if strings.Contains(link, "https://") {
 			window.sendEvent(newDebugMessage(err.Error() + "; trying over http://"))
-			return download(strings.Replace(link, "https://", "http://", 1),
+			return download(ctx, strings.Replace(link, "https://", "http://", 1),
 				mobile, checkDomain)
 		}
 		window.sendEvent(newErrorMessage(err))
-		return nil, ""
+		return nil, "", 0
 	}
 	window.sendEvent(newDebugMessage(response.Status))
 
@@ -60,135 +69,262 @@ func download(link string, mobile bool, checkDomain bool) (io.ReadCloser, string
 			window.sendEvent(newErrorMessage(errors.New("response came not from bandcamp.com")))
 			window.sendEvent(newDebugMessage(fmt.Sprint(response)))
 			response.Body.Close()
-			return nil, ""
+			return nil, "", 0
 		}
 	}
-	return response.Body, response.Header.Get("content-type")
+	return response.Body, response.Header.Get("content-type"), response.ContentLength
 }
 
-func processMediaPage(link string) {
-	defer wg.Done()
+// mode tells if new item replaces play queue or is added to it
+func processMediaPage(ctx context.Context, link string, mode queueMode) {
 	window.sendEvent(newMessage("fetching media page..."))
-	reader, _ := download(link, false, true)
-	if reader == nil {
-		window.sendEvent(newItem(nil))
+	item, releases, err := fetchPage(ctx, link)
+	if ctx.Err() != nil {
+		return
+	}
+
+	if err != nil {
+		window.sendEvent(newErrorMessage(err))
+		return
+	}
+
+	// discography can't be queued, it's opened instead
+	if releases != nil && releases.label {
+		window.sendEvent(newMessage("found label page"))
+		window.sendEvent(newReleases(releases))
+		return
+	} else if releases != nil {
+		window.sendEvent(newMessage("found discography"))
+		window.sendEvent(newReleases(releases))
 		return
 	}
+
+	window.sendEvent(newItem(item, mode))
+}
+
+// fetchMediaPage downloads and parses album/track page, if download
+// fails, error is already reported and both return values are nil
+func fetchMediaPage(ctx context.Context, link string) (*album, error) {
+	item, releases, err := fetchPage(ctx, link)
+	if releases != nil {
+		return nil, errors.New("not an album/track page: " + link)
+	}
+	return item, err
+}
+
+// fetchPage downloads and parses album/track page or artist/label
+// discography, only one of them is returned
+func fetchPage(ctx context.Context, link string) (*album, *releaseList, error) {
+	reader, _, _ := download(ctx, link, false, true)
+	if reader == nil {
+		return nil, nil, nil
+	}
 	defer reader.Close()
+
 	window.sendEvent(newMessage("parsing..."))
+	page, err := extractPage(reader)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	scanner := bufio.NewScanner(reader)
-	// NOTE: might fail here
-	// 64k is not enough for all pages apparently
-	// failed on a page with 43 tracks
-	var buffer []byte
-	scanner.Buffer(buffer, 131072)
 	var metaDataJSON string
-	var mediaDataJSON string
-	var err error
-	var isAlbum bool
-
-	// TODO: expects only album/track pages and artist page with pinned item
-	// if artist page is discography, will try to parse it as album/track
-	// doesn't crash, but doesn't need to get there in the first place
-	// NOTE: 5ccc945faa4b3243c4ab9f71ec53ed0c9a5c7df7 - absolutely zero idea
-	// what was here before and why, probably there was a reason for that
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.Contains(line, "og:type") {
-			if strings.Contains(line, "album") {
-				isAlbum = true
-			}
-		} else if strings.Contains(line, "application/ld+json") {
-			scanner.Scan()
-			metaDataJSON = scanner.Text()
-		} else if prefix := `data-tralbum="`; strings.Contains(line, prefix) {
-			mediaDataJSON, err = extractJSON(prefix, line, `"`)
+	if len(page.jsonLD) > 0 {
+		metaDataJSON = page.jsonLD[0]
+	}
+	mediaDataJSON := page.data["data-tralbum"]
+	isAlbum := page.ogType == "album"
+
+	// artist page without pinned item is a discography
+	if mediaDataJSON == "" {
+		releases, err := parseDiscography(page, link)
+		if err != nil {
+			return nil, nil, err
+		}
+		if releases != nil && releases.label {
+			fetchLabelPage(ctx, releases)
 		}
+		if releases != nil && (len(releases.releases) > 0 || len(releases.roster) > 0) {
+			return nil, releases, nil
+		}
+		if metaDataJSON == "" {
+			return nil, nil, errors.New("unexpected page format")
+		}
+	}
+
+	if !isAlbum {
+		window.sendEvent(newMessage("found track data"))
+	} else {
+		window.sendEvent(newMessage("found album data"))
+	}
+
+	item, err := parseTrAlbumJSON(metaDataJSON, mediaDataJSON, isAlbum)
+	return item, nil, err
+}
+
+// label pages are split in two, releases are on /music and roster is
+// on /artists, missing one is fetched too, it's fine if it fails
+func fetchLabelPage(ctx context.Context, list *releaseList) {
+	path := "/artists"
+	if len(list.roster) > 0 {
+		path = "/music"
 	}
 
+	base, err := url.Parse(list.url)
 	if err != nil {
-		window.sendEvent(newErrorMessage(err))
 		return
 	}
+	link := resolveURL(base, path)
 
-	if metaDataJSON != "" || mediaDataJSON != "" {
-		if !isAlbum {
-			window.sendEvent(newMessage("found track data"))
-		} else {
-			window.sendEvent(newMessage("found album data"))
-		}
+	window.sendEvent(newMessage("fetching label page..."))
+	reader, _, _ := download(ctx, link, false, true)
+	if reader == nil {
+		return
+	}
+	defer reader.Close()
 
-		metadata, err := parseTrAlbumJSON(metaDataJSON, mediaDataJSON, isAlbum)
+	page, err := extractPage(reader)
+	if err != nil {
+		window.sendEvent(newErrorMessage(err))
+		return
+	}
 
-		if err == nil {
-			window.sendEvent(newItem(metadata))
-		} else {
-			window.sendEvent(newErrorMessage(err))
-		}
+	other, err := parseDiscography(page, link)
+	if err != nil {
+		window.sendEvent(newErrorMessage(err))
+		return
+	}
+	if other == nil {
+		return
+	}
 
+	if len(list.roster) == 0 {
+		list.roster = other.roster
 	} else {
-		window.sendEvent(newErrorMessage(errors.New("unexpected page format")))
+		list.releases = other.releases
 	}
 }
 
-func downloadMedia(link string, track int) {
-	defer wg.Done()
+// preloaded tracks are downloaded quietly while current one is playing
+func downloadMedia(ctx context.Context, link, key string, j *job) {
 	var err error
-	key := getTruncatedURL(link)
+
+	message := func(text string) {
+		if preload, _ := downloads.isPreload(j); preload {
+			window.sendEvent(newDebugMessage(text))
+		} else {
+			window.sendEvent(newMessage(text))
+		}
+	}
+
+	done := func() {
+		if preload, track := downloads.isPreload(j); preload {
+			window.sendEvent(newTrackPreloaded(key, track))
+		} else {
+			window.sendEvent(newTrackDownloaded(key))
+		}
+	}
+
+	_, track := downloads.isPreload(j)
 
 	// TODO: move this check to upper level?
 	if _, ok := cache.get(key); ok {
-		window.sendEvent(newTrackDownloaded(key))
-		window.sendEvent(newMessage(fmt.Sprintf("playing track %d from cache",
-			track+1)))
+		done()
+		message(fmt.Sprintf("playing track %d from cache", track+1))
 		return
 	}
-	window.sendEvent(newMessage(fmt.Sprintf("fetching track %d...", track+1)))
+	if _, ok := buffers.finished(key); ok {
+		done()
+		return
+	}
+	message(fmt.Sprintf("fetching track %d...", track+1))
 	// NOTE: media location suggests that there is always only mp3 files on server
 	// for now ignore type of media
-	reader, _ := download(link, false, false)
+	reader, _, size := download(ctx, link, false, false)
 	if reader == nil {
 		return // error should be reported on other end already
 	}
 	defer reader.Close()
-	window.sendEvent(newMessage(fmt.Sprintf("downloading track %d...", track+1)))
+	message(fmt.Sprintf("downloading track %d...", track+1))
 
-	body, err := io.ReadAll(reader)
-	if err != nil {
-		window.sendEvent(newErrorMessage(err))
+	// playback can start before track is fully downloaded
+	buf := newBuffer()
+	buf.length = size
+	buffers.set(key, buf)
+
+	_, err = io.CopyN(buf, reader, bufferThreshold)
+	if err == nil {
+		if preload, _ := downloads.isPreload(j); !preload {
+			window.sendEvent(newTrackBuffered(key))
+		}
+		_, err = io.Copy(buf, reader)
+	}
+
+	if err != nil && !errors.Is(err, io.EOF) {
+		buf.close(err)
+		buffers.remove(key)
+		if ctx.Err() != nil {
+			window.sendEvent(newDebugMessage(fmt.Sprintf("track %d download cancelled",
+				track+1)))
+		} else {
+			window.sendEvent(newErrorMessage(err))
+		}
 		return
 	}
+	buf.close(nil)
 
-	cache.set(getTruncatedURL(link), body)
-	window.sendEvent(newTrackDownloaded(key))
-	window.sendEvent(newMessage(fmt.Sprintf("track %d downloaded", track+1)))
+	body, _ := buf.bytes()
+	if cache.set(key, body) {
+		buffers.remove(key)
+	} else {
+		// track is played from memory then
+		buffers.keep(key)
+	}
+	done()
+	message(fmt.Sprintf("track %d downloaded", track+1))
 }
 
-func downloadCover(link string) {
-	defer wg.Done()
+func downloadCover(ctx context.Context, link, key string) {
+	// image could be removed from memory, but still be on disk
+	if data, ok := images.stored(key); ok {
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err == nil {
+			images.set(key, img, nil)
+			window.sendEvent(newDebugMessage("album cover loaded from cache"))
+			window.sendEvent(newCoverDownloaded(img, link))
+			return
+		}
+	}
+
 	window.sendEvent(newDebugMessage("fetching album cover..."))
-	reader, format := download(link, false, false)
+	reader, format, _ := download(ctx, link, false, false)
 	if reader == nil {
-		window.sendEvent(newCoverDownloaded(nil, ""))
+		if ctx.Err() == nil {
+			window.sendEvent(newCoverDownloaded(nil, ""))
+		}
 		return
 	}
 	defer reader.Close()
 	window.sendEvent(newDebugMessage("downloading album cover..."))
 
+	data, err := io.ReadAll(reader)
+	if ctx.Err() != nil {
+		return
+	}
+
 	var img image.Image
-	var err error
-	switch format {
+	if err == nil {
+		switch format {
 
-	case "image/jpeg":
-		img, err = jpeg.Decode(reader)
+		case "image/jpeg":
+			img, err = jpeg.Decode(bytes.NewReader(data))
 
-	// in case there is png somewhere for whatever reason
-	case "image/png":
-		img, err = png.Decode(reader)
+		// in case there is png somewhere for whatever reason
+		case "image/png":
+			img, err = png.Decode(bytes.NewReader(data))
 
-	default:
-		img, err = nil, errors.New("unexpected image format")
+		default:
+			img, err = nil, errors.New("unexpected image format")
+		}
 	}
 
 	if err != nil {
@@ -197,59 +333,79 @@ func downloadCover(link string) {
 		return
 	}
 
+	images.set(key, img, data)
 	window.sendEvent(newDebugMessage("album cover downloaded"))
 	window.sendEvent(newCoverDownloaded(img, link))
 }
 
-func processTagPage(args arguments) {
-	defer wg.Done()
+func processTagPage(ctx context.Context, args arguments) {
+	window.sendEvent(newMessage("fetching data..."))
+	result := fetchTagSearch(ctx, args)
+	if result == nil {
+		return
+	}
+
+	window.sendEvent(newMessage("found data"))
+	window.sendEvent(newTagSearch(result))
+}
 
+// fetchTagSearch makes first request of the tag search, location is
+// resolved first, nil is returned if nothing was found, or if there
+// was an error, it is already reported
+func fetchTagSearch(ctx context.Context, args arguments) *DiscoverResult {
 	slice, err := SliceFromString(args.sort)
 	if err != nil {
 		window.sendEvent(newErrorMessage(err))
-		return
+		return nil
 	}
 
-	window.sendEvent(newMessage("fetching data..."))
+	if len(args.location) > 0 && args.geonameID == 0 {
+		window.sendEvent(newMessage("looking up location..."))
+		args.geonameID, err = resolveLocation(ctx, args)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if err != nil {
+			window.sendEvent(newErrorMessage(err))
+			return nil
+		}
 
-	result, err := makeDiscoverRequest(&DiscoverRequest{
+		// user has to choose one of the places
+		if args.geonameID == 0 {
+			return nil
+		}
+	}
+
+	result, err := makeDiscoverRequest(ctx, &DiscoverRequest{
 		CategoryID:         args.format,
 		Cursor:             "*",
-		GeonameID:          0,
-		IncludeResultTypes: []string{"a"},
+		GeonameID:          args.geonameID,
+		IncludeResultTypes: args.types,
 		Size:               60,
 		Slice:              slice,
 		TagNormNames:       args.tags,
 	})
+	if ctx.Err() != nil {
+		return nil
+	}
+
 	if err != nil {
 		window.sendEvent(newErrorMessage(err))
-		return
+		return nil
 	}
 
 	// FIXME: not sure if either can be trusted
 	if result.BatchResultCount == 0 || result.ResultCount == 0 ||
 		len(result.Results) == 0 {
 		window.sendEvent(newMessage("nothing was found"))
-		return
+		return nil
 	}
 
-	window.sendEvent(newMessage("found data"))
-	window.sendEvent(newTagSearch(result))
-}
-
-func extractJSON(prefix, line, suffix string) (string, error) {
-	start := strings.Index(line, prefix)
-	start += len(prefix)
-	end := strings.Index(line[start:], suffix)
-	end += start
-	if start == -1 || end == -1 || end < start {
-		return "", errors.New("unexpected page format")
-	}
-	replacer := strings.NewReplacer(`&quot;`, `"`, `&amp;`, `&`, `&#39;`, `'`)
-	return replacer.Replace(line[start:end]), nil
+	return result
 }
 
-// cache key = media url without any parameters
+// media url without any parameters
 func getTruncatedURL(link string) string {
 	if strings.Contains(link, "?") {
 		index := strings.Index(link, "?")
@@ -259,14 +415,15 @@ func getTruncatedURL(link string) string {
 	}
 }
 
-func getAdditionalResults(req *DiscoverRequest) {
-	defer wg.Done()
+func getAdditionalResults(ctx context.Context, req *DiscoverRequest) {
 	window.sendEvent(newMessage("pulling additional results..."))
 
-	result, err := makeDiscoverRequest(req)
+	result, err := makeDiscoverRequest(ctx, req)
 	if err != nil {
 		window.sendEvent(newAdditionalTagSearch(nil))
-		window.sendEvent(newErrorMessage(err))
+		if ctx.Err() == nil {
+			window.sendEvent(newErrorMessage(err))
+		}
 		return
 	}
 
@@ -280,7 +437,7 @@ func getAdditionalResults(req *DiscoverRequest) {
 	window.sendEvent(newAdditionalTagSearch(result))
 }
 
-func makeDiscoverRequest(req *DiscoverRequest) (*DiscoverResult, error) {
+func makeDiscoverRequest(ctx context.Context, req *DiscoverRequest) (*DiscoverResult, error) {
 	buf := bytes.Buffer{}
 	defer buf.Reset()
 
@@ -291,7 +448,8 @@ func makeDiscoverRequest(req *DiscoverRequest) (*DiscoverResult, error) {
 		return nil, fmt.Errorf("failed to encode request: %w", err)
 	}
 
-	r, err := http.NewRequest(
+	r, err := http.NewRequestWithContext(
+		ctx,
 		http.MethodPost,
 		"https://bandcamp.com/api/discover/1/discover_web",
 		&buf,
@@ -363,6 +521,7 @@ func makeDiscoverRequest(req *DiscoverRequest) (*DiscoverResult, error) {
 			result.ErrorType, req)
 	}
 
+	result.dedupe()
 	return result, nil
 
 }
@@ -10,6 +10,7 @@ import (
 	"net/url"
 	"os"
 	"runtime/debug"
+	"time"
 
 	"golang.org/x/net/http/httpproxy"
 	"golang.org/x/term"
@@ -126,42 +127,74 @@ type options struct {
 	noProxy                string
 	promptProxyCredentials bool
 	sampleRate             int
+	crossfade              time.Duration
+	cacheSize              int64
+	restore                bool
+	socket                 string
+	mpris                  bool
+	headless               bool
+	httpAddress            string
+	scrobbleURL            string
+	scrobbleToken          string
 
 	logFile *os.File
 }
 
 func readOptions() (int, *options) {
 	opt := options{
-		sampleRate: 44100,
+		sampleRate:  44100,
+		cacheSize:   defaultCacheSize,
+		socket:      getSocketPath(),
+		mpris:       true,
+		scrobbleURL: defaultScrobbleURL,
 	}
 
 	var help, version bool
+	var crossfade int
 
 	f := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
 	f.SetOutput(os.Stderr)
 
+	f.Int64Var(&opt.cacheSize, "cache-size", opt.cacheSize,
+		"size limit of the audio cache in `megabytes`")
 	f.StringVar(&opt.cpuProfile, "cpu-profile", opt.cpuProfile,
 		"write cpu profile to a `file`")
+	f.IntVar(&crossfade, "crossfade", crossfade,
+		"crossfade tracks for a given number of `seconds`")
 	f.BoolVar(&opt.debug, "debug", opt.debug,
 		"write debug output to 'dump.log' file")
 	f.BoolVar(&opt.debug, "d", opt.debug,
 		"write debug output to 'dump.log' file")
+	f.BoolVar(&opt.headless, "headless", opt.headless,
+		"run without user interface, player is controlled remotely")
 	f.BoolVar(&help, "help", help, "show this message and exit")
 	f.BoolVar(&help, "h", help, "show this message and exit")
+	f.StringVar(&opt.httpAddress, "http", opt.httpAddress,
+		"listen on `address` for HTTP API requests, localhost is used if host is omitted")
 	f.StringVar(&opt.httpProxy, "http-proxy", opt.httpProxy,
 		"URL of the HTTP proxy server")
 	f.StringVar(&opt.httpsProxy, "https-proxy", opt.httpProxy,
 		"URL of the HTTPS proxy server")
 	f.StringVar(&opt.memProfile, "mem-profile", opt.memProfile,
 		"write memory profile to a `file`")
+	f.BoolVar(&opt.mpris, "mpris", opt.mpris,
+		"expose player on the session bus over MPRIS interface")
 	f.StringVar(&opt.noProxy, "no-proxy", opt.noProxy,
 		"comma-separated list of hosts that should be excluded from proxying")
 	f.BoolVar(&version, "version", version, "show version and exit")
 	f.BoolVar(&version, "v", version, "show version and exit")
 	f.BoolVar(&opt.promptProxyCredentials, "w", opt.promptProxyCredentials,
 		"prompt proxy username and password")
+	f.BoolVar(&opt.restore, "restore", opt.restore,
+		"restore queue and settings from previous session")
 	f.IntVar(&opt.sampleRate, "sample-rate", opt.sampleRate,
 		"sample rate of player")
+	f.StringVar(&opt.scrobbleToken, "scrobble-token", opt.scrobbleToken,
+		"user `token` for scrobbling, $GOBANDCAMP_SCROBBLE_TOKEN is used if not set")
+	f.StringVar(&opt.scrobbleURL, "scrobble-url", opt.scrobbleURL,
+		"root `URL` of ListenBrainz compatible API for scrobbling")
+	f.StringVar(&opt.socket, "socket", opt.socket,
+		"path of the control `socket`, empty string disables it")
 
 	err := f.Parse(os.Args[1:])
 	if err != nil {
@@ -240,6 +273,36 @@ func readOptions() (int, *options) {
 		return 2, nil
 	}
 
+	if opt.cacheSize < minCacheSize {
+		fmt.Fprintf(os.Stderr, "invalid cache size value: %d, should be at least %d\n",
+			opt.cacheSize, minCacheSize)
+		return 2, nil
+	}
+
+	if crossfade < 0 {
+		fmt.Fprintln(os.Stderr, "invalid crossfade value:", crossfade)
+		return 2, nil
+	}
+	opt.crossfade = time.Duration(crossfade) * time.Second
+
+	// token is not a default value, so it's not shown in help
+	if opt.scrobbleToken == "" {
+		opt.scrobbleToken = os.Getenv("GOBANDCAMP_SCROBBLE_TOKEN")
+	}
+
+	if u, err := url.Parse(opt.scrobbleURL); err != nil ||
+		(u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		fmt.Fprintln(os.Stderr, "invalid scrobbling URL:", opt.scrobbleURL)
+		return 2, nil
+	}
+
+	// MPRIS is a stub on other systems
+	if opt.headless && opt.socket == "" && !(opt.mpris && mprisAvailable) &&
+		opt.httpAddress == "" {
+		fmt.Fprintln(os.Stderr, "headless mode requires control socket, HTTP API or MPRIS (linux)")
+		return 2, nil
+	}
+
 	// NOTE: open file as a last step, so it could be properly closed in main
 	if opt.debug {
 		f, err := os.Create("dump.log")
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// pageData is everything that is read from bandcamp page, it doesn't
+// depend on line layout or length, so there is no size limit
+type pageData struct {
+	ogType   string // album, song or band
+	siteName string
+	jsonLD   []string
+	// first occurrence of every data-* attribute, data-tralbum
+	// holds media data on album/track pages
+	data map[string]string
+
+	// music grid on artist and label pages, roster on label pages
+	hasGrid  bool
+	label    bool
+	releases []release
+	roster   []release
+}
+
+// pageParser follows position in the page, music grid of artist
+// and label pages looks like this:
+//
+//	<li data-item-id="album-123" class="music-grid-item ...">
+//	    <a href="/album/albumname">
+//	        <div class="art">
+//	            <img src="https://f4.bcbits.com/img/a456_2.jpg" alt="" />
+//	        </div>
+//	        <p class="title">
+//	            Album Name
+//	            <br><span class="artist-override">
+//	            Other Artist
+//	            </span>
+//	        </p>
+//	    </a>
+//	</li>
+//
+// label roster is a grid of artists:
+//
+//	<li class="artists-grid-item">
+//	    <a href="https://artistname.bandcamp.com?label=123&amp;tab=artists">
+//	        <div class="art"><img src="..."></div>
+//	        <div class="artists-grid-name">Artist Name</div>
+//	        <div class="artists-grid-location secondaryText">City, Country</div>
+//	    </a>
+//	</li>
+type pageParser struct {
+	page     *pageData
+	inJSONLD bool
+
+	// element of the grid that is being read, it's added to
+	// the list, when it ends, in case markup omits closing tag,
+	// when next one starts or page ends
+	item    *release
+	list    *[]release
+	field   *string // text goes here
+	element string  // tag that ends text
+}
+
+// extractPage reads whole page with tokenizer, it doesn't stop at the
+// end of album data, since page could have several of them
+func extractPage(reader io.Reader) (*pageData, error) {
+	p := &pageParser{page: &pageData{data: make(map[string]string)}}
+	tokenizer := html.NewTokenizer(reader)
+
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			if err := tokenizer.Err(); !errors.Is(err, io.EOF) {
+				return nil, err
+			}
+			p.endItem()
+			return p.page, nil
+
+		case html.TextToken:
+			p.text(string(tokenizer.Text()))
+
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			p.endTag(string(name))
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := tokenizer.TagName()
+			attrs := make(map[string]string)
+			for hasAttr {
+				var key, value []byte
+				key, value, hasAttr = tokenizer.TagAttr()
+				attrs[string(key)] = string(value)
+			}
+			p.startTag(string(name), attrs)
+		}
+	}
+}
+
+func (p *pageParser) text(text string) {
+	if p.inJSONLD {
+		p.page.jsonLD = append(p.page.jsonLD, strings.TrimSpace(text))
+	} else if p.field != nil && *p.field == "" {
+		*p.field = strings.TrimSpace(text)
+	}
+}
+
+func (p *pageParser) endTag(name string) {
+	switch name {
+	case "script":
+		p.inJSONLD = false
+	case "li":
+		p.endItem()
+	case p.element:
+		p.field, p.element = nil, ""
+	}
+}
+
+func (p *pageParser) endItem() {
+	if p.item != nil {
+		*p.list = append(*p.list, *p.item)
+	}
+	p.item, p.list, p.field, p.element = nil, nil, nil, ""
+}
+
+func (p *pageParser) startTag(name string, attrs map[string]string) {
+	page := p.page
+	for key, value := range attrs {
+		if _, ok := page.data[key]; !ok && strings.HasPrefix(key, "data-") {
+			page.data[key] = value
+		}
+	}
+	class := strings.Fields(attrs["class"])
+
+	switch {
+	case name == "meta" && attrs["property"] == "og:type":
+		page.ogType = attrs["content"]
+
+	case name == "meta" && attrs["property"] == "og:site_name":
+		page.siteName = attrs["content"]
+
+	case name == "script" && attrs["type"] == "application/ld+json":
+		p.inJSONLD = true
+
+	// only labels have artists tab
+	case name == "a" && attrs["href"] == "/artists":
+		page.label = true
+
+	case name == "ol" && attrs["id"] == "music-grid":
+		page.hasGrid = true
+
+	case name == "li" && slices.Contains(class, "music-grid-item"):
+		kind := "album"
+		if strings.HasPrefix(attrs["data-item-id"], "track-") {
+			kind = "track"
+		}
+		p.endItem()
+		p.item, p.list = &release{kind: kind}, &page.releases
+
+	case name == "li" && slices.Contains(class, "artists-grid-item"):
+		page.label = true
+		p.endItem()
+		p.item, p.list = &release{kind: "artist"}, &page.roster
+
+	case p.item == nil:
+
+	case name == "a" && p.item.url == "":
+		p.item.url = attrs["href"]
+
+	case name == "img":
+		src := attrs["src"]
+		if original, ok := attrs["data-original"]; ok {
+			src = original
+		}
+		p.item.artID = getArtIDFromURL(src)
+
+	case name == "p" && slices.Contains(class, "title"):
+		p.field, p.element = &p.item.title, "p"
+
+	case name == "span" && slices.Contains(class, "artist-override"):
+		p.field, p.element = &p.item.artist, "span"
+
+	case name == "div" && slices.Contains(class, "artists-grid-name"):
+		p.field, p.element = &p.item.title, "div"
+
+	case name == "div" && slices.Contains(class, "artists-grid-location"):
+		p.field, p.element = &p.item.artist, "div"
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func readPageFixture(t *testing.T, name string) *pageData {
+	t.Helper()
+	page, err := extractPage(bytes.NewReader(readFixture(t, name)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return page
+}
+
+func TestExtractPageAlbum(t *testing.T) {
+	page := readPageFixture(t, "album_page.html")
+
+	if page.ogType != "album" {
+		t.Errorf(formatStr, "wrong page type", "album", page.ogType)
+	}
+
+	if len(page.jsonLD) != 1 || page.jsonLD[0] != metaData {
+		t.Errorf(formatStr, "wrong ld+json blocks", 1, len(page.jsonLD))
+	}
+
+	if page.data["data-tralbum"] != mediaData {
+		t.Errorf(formatStr, "wrong data-tralbum attribute",
+			mediaData, page.data["data-tralbum"])
+	}
+
+	if got := page.data["data-cart"]; got != `{"currency":"USD"}` {
+		t.Errorf(formatStr, "wrong data-cart attribute", `{"currency":"USD"}`, got)
+	}
+
+	if page.hasGrid || page.label {
+		t.Errorf(formatStr, "album page is not a discography", false, true)
+	}
+
+	gotData, err := parseTrAlbumJSON(page.jsonLD[0], page.data["data-tralbum"], true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if gotData.title != wantData.title || gotData.totalTracks != wantData.totalTracks {
+		t.Errorf(formatStr, "wrong album data", wantData, gotData)
+	}
+}
+
+// same page without line breaks and with a line longer than
+// any scanner buffer used before
+func TestExtractPageLongLines(t *testing.T) {
+	data, err := os.ReadFile("testdata/album_page.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	padding := "<div>" + strings.Repeat("gopher ", 64*1024) + "</div>"
+	text := strings.ReplaceAll(string(data), "\n", " ")
+	text = strings.Replace(text, "<body>", "<body>"+padding, 1)
+
+	page, err := extractPage(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if page.ogType != "album" {
+		t.Errorf(formatStr, "wrong page type", "album", page.ogType)
+	}
+
+	if page.data["data-tralbum"] != mediaData {
+		t.Errorf(formatStr, "wrong data-tralbum attribute",
+			len(mediaData), len(page.data["data-tralbum"]))
+	}
+}
+
+// grid items are complete, even if markup omits closing tags
+func TestExtractPageGridWithoutClosingTags(t *testing.T) {
+	data := readFixture(t, "artist_music.html")
+	want, err := extractPage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := strings.ReplaceAll(string(data), "</li>", "")
+	page, err := extractPage(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(want.releases) != 2 {
+		t.Fatalf(formatStr, "wrong number of releases", 2, len(want.releases))
+	}
+	if !reflect.DeepEqual(page.releases, want.releases) {
+		t.Errorf(formatStr, "wrong releases", want.releases, page.releases)
+	}
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"math"
 	"math/rand"
 	"time"
@@ -50,30 +52,57 @@ type streamPlayer struct {
 	totalTracks  int
 	p            *audio.Player
 	ctx          *audio.Context
+	stream       *stream
+	key          string
+	partial      *partialDecoder
 	timeStep     time.Duration
 	duration     time.Duration
 	sampleRate   int
 
+	// track that will be played after current one, -1 if not picked yet,
+	// queued is set when it is already decoded and waits in stream
+	pending         int
+	pendingKey      string
+	pendingDuration time.Duration
+	queued          bool
+
+	// time when current track started playing, it's updated
+	// when track is played again
+	started time.Time
+
 	status         playbackStatus
 	bufferedStatus playbackStatus
 	playbackMode   playbackMode
 	volume         float64
 	muted          bool
 
+	// crossfade is 0 if disabled, fadeLength is used when enabled again
+	crossfade  time.Duration
+	fadeLength time.Duration
+
 	text chan<- interface{}
-	next chan<- struct{}
+	next chan<- bool
 }
 
-func newPlayer(sampleRate int, text chan<- interface{}, next chan<- struct{}) *streamPlayer {
+func newPlayer(sampleRate int, crossfade time.Duration, text chan<- interface{}, next chan<- bool) *streamPlayer {
 	ctx := audio.NewContext(sampleRate)
-	return &streamPlayer{
+	p := &streamPlayer{
 		ctx:        ctx,
 		timeStep:   2 * time.Second,
 		sampleRate: sampleRate,
 		volume:     1.0,
+		pending:    -1,
+		crossfade:  crossfade,
+		fadeLength: crossfade,
 		text:       text,
 		next:       next,
 	}
+
+	if p.fadeLength == 0 {
+		p.fadeLength = 5 * time.Second
+	}
+
+	return p
 }
 
 func (p *streamPlayer) raiseVolume() {
@@ -101,6 +130,18 @@ func (p *streamPlayer) lowerVolume() {
 	p.setVolume()
 }
 
+// changeVolume sets volume from 0 to 1
+func (p *streamPlayer) changeVolume(volume float64) {
+	p.volume = math.Min(math.Max(volume, 0.0), 1.0)
+	p.muted = p.volume < 0.01
+
+	if p.p != nil && p.muted {
+		p.p.SetVolume(0.0)
+		return
+	}
+	p.setVolume()
+}
+
 func (p *streamPlayer) setVolume() {
 	if p.p != nil {
 		p.p.SetVolume(p.adjustedVolume())
@@ -126,6 +167,25 @@ func (p *streamPlayer) getVolume() string {
 	return fmt.Sprintf("%4.0f", p.volume*100)
 }
 
+func (p *streamPlayer) toggleCrossfade() {
+	if p.crossfade == 0 {
+		p.crossfade = p.fadeLength
+	} else {
+		p.crossfade = 0
+	}
+
+	if p.stream != nil {
+		p.stream.setFade(p.durationToBytes(p.crossfade))
+	}
+}
+
+func (p *streamPlayer) getCrossfade() string {
+	if p.crossfade == 0 {
+		return "off"
+	}
+	return p.crossfade.String()
+}
+
 func (p *streamPlayer) getCurrentTrack() int {
 	return p.currentTrack
 }
@@ -152,7 +212,7 @@ func (p *streamPlayer) seek(forward bool) bool {
 		return false
 	}
 
-	pos := p.p.Position()
+	pos := p.getPosition()
 
 	offset := p.timeStep
 	if forward {
@@ -169,7 +229,7 @@ func (p *streamPlayer) seek(forward bool) bool {
 		pos = p.duration
 	}
 
-	if err := p.p.SetPosition(pos); err != nil {
+	if err := p.setPosition(pos); err != nil {
 		if err != nil {
 			p.text <- err
 		}
@@ -178,18 +238,56 @@ func (p *streamPlayer) seek(forward bool) bool {
 	return true
 }
 
+// seekTo jumps to given position, if track is still downloading,
+// playback waits until data at that position is there
+func (p *streamPlayer) seekTo(pos time.Duration) error {
+	if p.p == nil {
+		return errors.New("nothing is playing")
+	}
+
+	if pos > p.duration {
+		pos = p.duration
+	}
+
+	return p.setPosition(pos)
+}
+
 func (p *streamPlayer) resetPosition() {
 	p.text <- "reset position"
-	if err := p.p.Rewind(); err != nil {
+	if err := p.setPosition(0); err != nil {
 		p.text <- err
 	}
 }
 
-func (p *streamPlayer) getCurrentTrackPosition() time.Duration {
-	if p.p != nil {
-		return p.p.Position().Truncate(time.Second)
+// audio player counts position from the start of the stream,
+// which can hold several tracks, convert it to position in current track
+func (p *streamPlayer) getPosition() time.Duration {
+	if p.p == nil {
+		return 0
+	}
+
+	pos := p.p.Position() - p.bytesToDuration(p.stream.start())
+	if pos < 0 {
+		return 0
 	}
-	return 0
+	return pos
+}
+
+func (p *streamPlayer) setPosition(pos time.Duration) error {
+	return p.p.SetPosition(pos + p.bytesToDuration(p.stream.start()))
+}
+
+func (p *streamPlayer) bytesToDuration(size int64) time.Duration {
+	// 2 channels, 4 bytes per sample
+	return time.Duration(size/8) * time.Second / time.Duration(p.sampleRate)
+}
+
+func (p *streamPlayer) durationToBytes(d time.Duration) int64 {
+	return int64(d) * int64(p.sampleRate) / int64(time.Second) * 8
+}
+
+func (p *streamPlayer) getCurrentTrackPosition() time.Duration {
+	return p.getPosition().Truncate(time.Second)
 }
 
 // play/pause/seekFWD/seekBWD count as active state
@@ -225,65 +323,103 @@ func (p *streamPlayer) skip(direction int) bool {
 		p.status = skipBWD
 	}
 
-	// TODO: remove after response reading cancellation is implemented
-	go p.delaySwitching()
+	window.sendEvent(newTrack(p.currentTrack))
 	return true
 }
 
 func (p *streamPlayer) nextMode() {
 	p.playbackMode = (p.playbackMode + 1) % 4
+	// next track depends on mode, pick it again
+	p.dropPending()
 }
 
-func (p *streamPlayer) nextTrack() {
-	p.text <- "next track"
+// returns track that should be played after current one,
+// false if playback should stop after current track
+func (p *streamPlayer) getNextTrack() (int, bool) {
+	if p.totalTracks == 0 {
+		return -1, false
+	}
+
+	if p.pending >= 0 {
+		return p.pending, true
+	}
+
 	switch p.playbackMode {
 
 	case random:
-		var previousTrack int
-
-		if p.totalTracks > 1 {
-			previousTrack = p.currentTrack
-			// never play same track again if random
-			for p.currentTrack == previousTrack {
-				p.currentTrack = rand.Intn(p.totalTracks)
-			}
+		p.pending = p.currentTrack
+		// never play same track again if random
+		for p.totalTracks > 1 && p.pending == p.currentTrack {
+			p.pending = rand.Intn(p.totalTracks)
 		}
-		p.stop()
-
-		if p.currentTrack >= previousTrack {
-			p.status = skipFWD
-		} else {
-			p.status = skipBWD
-		}
-
-		p.clearStream()
-		go p.delaySwitching()
 
 	case repeatOne:
-		p.skip(0)
+		p.pending = p.currentTrack
 
 	case repeat:
-		p.skip(1)
+		p.pending = (p.currentTrack + 1) % p.totalTracks
 
 	case normal:
 		if p.currentTrack == p.totalTracks-1 {
-			p.stop()
-			return
+			return -1, false
 		}
-		p.skip(1)
+		p.pending = p.currentTrack + 1
 	}
+
+	return p.pending, true
 }
 
-// to prevent downloading every item on fast track switching
-// probably dumb idea
-func (p *streamPlayer) delaySwitching() {
-	track := p.currentTrack
+func (p *streamPlayer) nextTrack() {
+	p.text <- "next track"
+	track, ok := p.getNextTrack()
+	if !ok {
+		p.stop()
+		return
+	}
+	p.setTrack(track)
+}
+
+// queue decodes downloaded track and puts it in stream right after
+// current one, player will switch to it without stopping
+func (p *streamPlayer) queue(key string) {
+	if p.stream == nil || p.pending < 0 {
+		return
+	}
+
+	r, size, _, err := p.decode(key, 0)
+	if err != nil {
+		p.text <- err
+		return
+	}
+
+	p.stream.queue(r, size)
+	p.pendingKey = key
+	p.pendingDuration = p.bytesToDuration(size).Truncate(time.Second)
+	p.queued = true
+	p.text <- "next track queued"
+}
 
-	time.Sleep(time.Second / 2)
+// current track ended and stream moved on to the queued one
+func (p *streamPlayer) advance() {
+	if !p.queued {
+		return
+	}
+
+	p.text <- "switched to next track"
+	p.currentTrack = p.pending
+	p.key = p.pendingKey
+	p.duration = p.pendingDuration
+	p.pending = -1
+	p.queued = false
+	p.started = time.Now()
+}
 
-	if track == p.currentTrack {
-		window.sendEvent(newTrack(p.currentTrack))
+func (p *streamPlayer) dropPending() {
+	if p.stream != nil {
+		p.stream.queue(nil, 0)
 	}
+	p.pending = -1
+	p.queued = false
 }
 
 func (p *streamPlayer) setTrack(track int) {
@@ -295,49 +431,80 @@ func (p *streamPlayer) setTrack(track int) {
 		p.status = skipBWD
 	}
 	p.currentTrack = track
-	go p.delaySwitching()
+	window.sendEvent(newTrack(p.currentTrack))
 }
 
-func (p *streamPlayer) play(key string) {
-	// FIXME: this code does not belong here
+// decodes track from cache, if track is still downloading decodes
+// whatever is available, reads will wait for the rest of data, size
+// of such stream is estimated from duration
+func (p *streamPlayer) decode(key string, duration float64) (io.ReadSeeker, int64, *partialDecoder, error) {
 	value, ok := cache.get(key)
 	if !ok {
-		p.text <- "missing cache entry"
-		return
+		// track didn't fit into cache
+		value, ok = buffers.finished(key)
 	}
 
-	// FIXME: there are a lot of mental acrobatics below just
-	//        to get real duration out of the stream and not
-	//        from server response, this is needed to not get
-	//        out of bounds when setting postition, which is
-	//        for some reason is not done automagically
-	s, err := mp3.DecodeF32(bytes.NewReader(value))
+	// FIXME: this code does not belong here
+	if ok {
+		// FIXME: there are a lot of mental acrobatics below just
+		//        to get real duration out of the stream and not
+		//        from server response, this is needed to not get
+		//        out of bounds when setting postition, which is
+		//        for some reason is not done automagically
+		s, err := mp3.DecodeF32(bytes.NewReader(value))
+		if err != nil {
+			return nil, 0, nil, err
+		}
+
+		// this function returns interface, which does not
+		// implement Length() int64, why?
+		r := audio.ResampleReaderF32(s, s.Length(), s.SampleRate(), p.sampleRate)
+
+		return r.(io.ReadSeeker), r.(length).Length(), nil, nil
+	}
+
+	buf, ok := buffers.get(key)
+	if !ok {
+		return nil, 0, nil, errors.New("missing cache entry")
+	}
+
+	d, sampleRate, err := newPartialDecoder(buf, duration)
 	if err != nil {
-		p.text <- err
-		return
+		return nil, 0, nil, err
 	}
 
-	// this function returns interface, which does not
-	// implement Length() int64, why?
-	r := audio.ResampleReaderF32(s, s.Length(), s.SampleRate(), p.sampleRate)
+	r := audio.ResampleReaderF32(d, d.length, sampleRate, p.sampleRate)
 
-	stream := newCallback(r, func() { p.next <- struct{}{} })
+	return r.(io.ReadSeeker), p.durationToBytes(time.Duration(duration * float64(time.Second))),
+		d, nil
+}
+
+// duration is only used if track is not fully downloaded yet
+func (p *streamPlayer) play(key string, duration float64) {
+	r, size, partial, err := p.decode(key, duration)
+	if err != nil {
+		p.text <- err
+		return
+	}
 
 	if p.p != nil {
 		p.p.Close()
 	}
 
-	size := r.(length).Length()
-
-	p.duration = time.Duration(size/(2*int64(p.sampleRate)*4)) * time.Second
+	p.key = key
+	p.partial = partial
+	p.stream = newStream(r, size, func(switched bool) { p.next <- switched })
+	p.stream.setFade(p.durationToBytes(p.crossfade))
+	p.duration = p.bytesToDuration(size).Truncate(time.Second)
 
-	p.p, err = p.ctx.NewPlayerF32(stream)
+	p.p, err = p.ctx.NewPlayerF32(p.stream)
 	if err != nil {
 		p.text <- err
 		return
 	}
 
 	p.status = playing
+	p.started = time.Now()
 
 	if p.muted {
 		p.p.SetVolume(0.0)
@@ -349,12 +516,42 @@ func (p *streamPlayer) play(key string) {
 	p.p.Play()
 }
 
+// true if track is being played while it is still downloading
+func (p *streamPlayer) isStreaming(key string) bool {
+	return p.stream != nil && p.partial != nil && p.key == key
+}
+
+// track finished downloading while it was playing, replace stream
+// that was decoded on the fly with the one of exact length
+func (p *streamPlayer) complete(key string) {
+	if !p.isStreaming(key) {
+		return
+	}
+
+	r, size, _, err := p.decode(key, 0)
+	if err != nil {
+		p.text <- err
+		return
+	}
+
+	if err := p.stream.replace(r, size); err != nil {
+		p.text <- err
+		return
+	}
+
+	p.partial.Close()
+	p.partial = nil
+	p.duration = p.bytesToDuration(size).Truncate(time.Second)
+	p.text <- "track fully downloaded"
+}
+
 func (p *streamPlayer) restart() {
 	p.text <- "restart playback"
 	if p.p != nil {
 		p.resetPosition()
 		p.p.Play()
 		p.status = playing
+		p.started = time.Now()
 	}
 }
 
@@ -370,9 +567,17 @@ func (p *streamPlayer) stop() {
 
 func (p *streamPlayer) clearStream() {
 	p.text <- "clearing buffer"
+	p.dropPending()
+	// unblock reading if it is waiting for download
+	if p.partial != nil {
+		p.partial.Close()
+		p.partial = nil
+	}
+
 	if p.p != nil {
 		err := p.p.Close()
 		p.p = nil
+		p.stream = nil
 		p.duration = 0
 		if err != nil {
 			p.text <- err
@@ -392,6 +597,10 @@ func (p *streamPlayer) playPause() bool {
 	switch p.status {
 
 	case paused, stopped:
+		// stopped track starts from the beginning
+		if p.status == stopped {
+			p.started = time.Now()
+		}
 		p.status = playing
 		p.p.Play()
 
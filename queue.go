@@ -0,0 +1,120 @@
+package main
+
+import "fmt"
+
+// how new item is added to the play queue
+type queueMode int
+
+const (
+	queueReplace queueMode = iota
+	queueAppend
+	queueNext
+	// played right after current track, search results stay on screen
+	queuePreview
+)
+
+// queueEntry is a single track in the play queue, album it came
+// from is shared between all of its tracks
+type queueEntry struct {
+	item  *album
+	track int
+}
+
+// playQueue holds tracks from any number of albums and tracks,
+// player position is an index in this queue
+type playQueue struct {
+	entries []queueEntry
+}
+
+func newQueue() *playQueue {
+	return &playQueue{}
+}
+
+func (queue *playQueue) len() int {
+	return len(queue.entries)
+}
+
+func (queue *playQueue) isEmpty() bool {
+	return len(queue.entries) == 0
+}
+
+// get returns album and its track at given position of the queue
+func (queue *playQueue) get(pos int) (*album, *track) {
+	if pos < 0 || pos >= len(queue.entries) {
+		return nil, nil
+	}
+	entry := queue.entries[pos]
+	return entry.item, &entry.item.tracks[entry.track]
+}
+
+// sameItem is true if tracks at both positions come from the same album
+func (queue *playQueue) sameItem(a, b int) bool {
+	if a < 0 || b < 0 || a >= len(queue.entries) || b >= len(queue.entries) {
+		return false
+	}
+	return queue.entries[a].item == queue.entries[b].item
+}
+
+func (queue *playQueue) replace(item *album) {
+	queue.entries = queue.entries[:0]
+	queue.insert(item, 0)
+}
+
+// insert puts all tracks of the item at given position,
+// returns number of added tracks
+func (queue *playQueue) insert(item *album, pos int) int {
+	if pos < 0 || pos > len(queue.entries) {
+		pos = len(queue.entries)
+	}
+
+	entries := make([]queueEntry, len(item.tracks))
+	for i := range item.tracks {
+		entries[i] = queueEntry{item: item, track: i}
+	}
+
+	queue.entries = append(queue.entries[:pos],
+		append(entries, queue.entries[pos:]...)...)
+	return len(entries)
+}
+
+// add puts single track of the item at the end of the queue
+func (queue *playQueue) add(item *album, track int) {
+	if track < 0 || track >= len(item.tracks) {
+		return
+	}
+	queue.entries = append(queue.entries, queueEntry{item: item, track: track})
+}
+
+func (queue *playQueue) remove(pos int) {
+	if pos < 0 || pos >= len(queue.entries) {
+		return
+	}
+	queue.entries = append(queue.entries[:pos], queue.entries[pos+1:]...)
+}
+
+// move puts entry from one position to another, positions
+// of everything in between shift by one
+func (queue *playQueue) move(from, to int) bool {
+	if from < 0 || from >= len(queue.entries) ||
+		to < 0 || to >= len(queue.entries) || from == to {
+		return false
+	}
+
+	entry := queue.entries[from]
+	if from < to {
+		copy(queue.entries[from:], queue.entries[from+1:to+1])
+	} else {
+		copy(queue.entries[to+1:], queue.entries[to:from])
+	}
+	queue.entries[to] = entry
+	return true
+}
+
+func (queue *playQueue) String() string {
+	var s string
+	for i, entry := range queue.entries {
+		s += fmt.Sprintf("%d: %s - %s\n", i+1, entry.item.title,
+			entry.item.tracks[entry.track].title)
+	}
+	return s
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// items played in this session, plays before radio was started count
+// as heard too, history could be disabled, so they are kept separately,
+// only used from the event loop
+var sessionPlayed = make(map[string]bool)
+
+// number of tracks that radio keeps in the queue after current one,
+// and number of results left, when next page is requested
+const (
+	radioTracksAhead = 2
+	radioLowResults  = 5
+	// station ends if pages don't bring anything new
+	radioStalePages = 3
+)
+
+// radioStation goes through pages of tag search results and adds them
+// to the queue one by one, station is only used from the event loop,
+// downloads only pass it back with the results
+type radioStation struct {
+	args    arguments
+	next    *DiscoverRequest // nil after the last page
+	pending []Result
+	heard   map[string]bool
+
+	fetching bool // next page is downloading
+	loading  bool // album page is downloading
+	finished bool
+	// pages in a row without anything new
+	stale int
+}
+
+// newRadio starts station with the first page of results,
+// items that were already played in this session are skipped
+func newRadio(args arguments, result *DiscoverResult) *radioStation {
+	r := &radioStation{
+		args:  args,
+		heard: make(map[string]bool),
+	}
+
+	for url := range sessionPlayed {
+		r.heard[url] = true
+	}
+
+	r.add(result)
+	return r
+}
+
+// add keeps unheard results of the page and prepares request
+// for the next one
+func (r *radioStation) add(result *DiscoverResult) {
+	var fresh []Result
+	for _, item := range result.Results {
+		url := getItemKey(item.ItemURL)
+		if url == "" || r.heard[url] {
+			continue
+		}
+		// same item could be on several pages
+		r.heard[url] = true
+		fresh = append(fresh, item)
+	}
+
+	if r.args.shuffle {
+		rand.Shuffle(len(fresh), func(i, j int) {
+			fresh[i], fresh[j] = fresh[j], fresh[i]
+		})
+	}
+	r.pending = append(r.pending, fresh...)
+
+	if len(fresh) == 0 {
+		r.stale++
+	} else {
+		r.stale = 0
+	}
+
+	r.next = nil
+	if result.Cursor != nil && result.Request != nil && r.stale < radioStalePages {
+		req := *result.Request
+		req.Cursor = *result.Cursor
+		r.next = &req
+	}
+}
+
+// fill keeps few tracks ahead of current one in the queue,
+// next page is requested in background before results run out
+func (r *radioStation) fill() {
+	if r == nil {
+		return
+	}
+
+	for !r.loading && len(r.pending) > 0 &&
+		window.playlist.len()-1-player.currentTrack < radioTracksAhead {
+		result := r.pending[0]
+		r.pending = r.pending[1:]
+
+		if r.args.album {
+			r.loading = true
+			downloads.radioItem(r, result.ItemURL)
+			break
+		}
+
+		if result.FeaturedTrack.StreamURL == "" {
+			continue
+		}
+		window.addRadioItem(extractFeaturedTrack(&result))
+	}
+
+	if !r.fetching && r.next != nil && len(r.pending) < radioLowResults {
+		r.fetching = true
+		downloads.radioPage(r, r.next)
+	}
+
+	if !r.finished && !r.fetching && !r.loading && len(r.pending) == 0 &&
+		r.next == nil {
+		r.finished = true
+		window.sendEvent(newMessage("radio: no more results"))
+	}
+}
+
+// same item has different links depending on where it was found
+func getItemKey(link string) string {
+	url, _, _ := strings.Cut(link, "?")
+	return url
+}
+
+// markPlayed remembers item of the track as heard
+func (window *windowLayout) markPlayed(track int) {
+	if item, _ := window.playlist.get(track); item != nil &&
+		item.url != "" {
+		sessionPlayed[getItemKey(item.url)] = true
+	}
+}
+
+// addRadioItem puts item at the end of the queue, if queue is empty,
+// playback starts right away
+func (window *windowLayout) addRadioItem(item *album) {
+	if window.playlist.isEmpty() {
+		window.replaceQueue(item)
+	} else {
+		window.playlist.insert(item, window.playlist.len())
+		window.queueChanged()
+	}
+	window.updateContent(newItem(item, queueAppend))
+}
+
+// startRadio replaces queue with items of the new station
+func (window *windowLayout) startRadio(args arguments, result *DiscoverResult) {
+	player.stop()
+	player.clearStream()
+	window.playlist = newQueue()
+	player.currentTrack = 0
+	player.totalTracks = 0
+
+	window.radio = newRadio(args, result)
+	window.sendEvent(newMessage(fmt.Sprintf("radio: %s, %d items",
+		strings.Join(args.tags, " "), len(window.radio.pending))))
+	window.radio.fill()
+}
+
+// stopRadio ends station, queue is left as it is
+func (window *windowLayout) stopRadio() {
+	if window.radio == nil {
+		return
+	}
+	window.radio = nil
+	downloads.stopRadio()
+	window.sendEvent(newMessage("radio stopped"))
+}
+
+// processRadio fetches first page of the station
+func processRadio(ctx context.Context, args arguments) {
+	window.sendEvent(newMessage("tuning in..."))
+	result := fetchTagSearch(ctx, args)
+	if result == nil {
+		return
+	}
+	window.sendEvent(newRadioStart(args, result))
+}
+
+// page that failed to load ends the station, album that failed
+// is skipped
+func processRadioPage(ctx context.Context, r *radioStation, req *DiscoverRequest) {
+	result, err := makeDiscoverRequest(ctx, req)
+	if ctx.Err() != nil {
+		return
+	}
+
+	if err != nil {
+		window.sendEvent(newErrorMessage(err))
+		result = nil
+	}
+	window.sendEvent(newRadioPage(r, result))
+}
+
+func processRadioItem(ctx context.Context, r *radioStation, link string) {
+	item, err := fetchMediaPage(ctx, link)
+	if ctx.Err() != nil {
+		return
+	}
+
+	if err != nil {
+		window.sendEvent(newErrorMessage(err))
+	}
+	window.sendEvent(newRadioItem(r, item))
+}
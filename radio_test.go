@@ -0,0 +1,102 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// radioPage makes page of results with given links, titles are
+// same as links, empty cursor means it's the last page
+func radioPage(cursor string, links ...string) *DiscoverResult {
+	result := &DiscoverResult{
+		Request: &DiscoverRequest{TagNormNames: []string{"ambient"}, Size: 60},
+	}
+	if cursor != "" {
+		result.Cursor = &cursor
+	}
+	for _, link := range links {
+		result.Results = append(result.Results, Result{Title: link, ItemURL: link})
+	}
+	return result
+}
+
+func TestRadioPaging(t *testing.T) {
+	first := radioPage("page2", "a", "b")
+	r := newRadio(arguments{}, first)
+
+	if r.next == nil {
+		t.Fatal("next page should be requested")
+	}
+	if r.next.Cursor != "page2" {
+		t.Errorf(formatStr, "wrong cursor", "page2", r.next.Cursor)
+	}
+	if !reflect.DeepEqual(r.next.TagNormNames, []string{"ambient"}) {
+		t.Errorf(formatStr, "wrong tags", []string{"ambient"}, r.next.TagNormNames)
+	}
+	if first.Request.Cursor != "" {
+		t.Errorf(formatStr, "request of the page was changed", "", first.Request.Cursor)
+	}
+
+	r.add(radioPage("", "c"))
+	if r.next != nil {
+		t.Errorf(formatStr, "last page should end paging", nil, r.next)
+	}
+
+	want := []string{"a", "b", "c"}
+	if got := getResultTitles(r.pending); !reflect.DeepEqual(got, want) {
+		t.Errorf(formatStr, "wrong pending results", want, got)
+	}
+}
+
+func TestRadioStalePages(t *testing.T) {
+	r := newRadio(arguments{}, radioPage("next", "a"))
+
+	// new item resets counter
+	r.add(radioPage("next", "a"))
+	r.add(radioPage("next", "b"))
+	if r.stale != 0 || r.next == nil {
+		t.Fatalf(formatStr, "page with new item is not stale", 0, r.stale)
+	}
+
+	for i := 1; i < radioStalePages; i++ {
+		r.add(radioPage("next", "a", "b"))
+		if r.next == nil {
+			t.Fatalf(formatStr, "station stopped too early", radioStalePages, i)
+		}
+	}
+
+	r.add(radioPage("next", "b"))
+	if r.stale != radioStalePages {
+		t.Errorf(formatStr, "wrong number of stale pages", radioStalePages, r.stale)
+	}
+	if r.next != nil {
+		t.Errorf(formatStr, "stale pages should end paging", nil, r.next)
+	}
+}
+
+func TestRadioSkipsHeard(t *testing.T) {
+	saved := sessionPlayed
+	defer func() { sessionPlayed = saved }()
+
+	sessionPlayed = map[string]bool{
+		"https://gopher.bandcamp.com/album/heard": true,
+	}
+
+	r := newRadio(arguments{}, radioPage("",
+		"https://gopher.bandcamp.com/album/heard?from=discover_page",
+		"https://gopher.bandcamp.com/album/new?from=discover_page",
+		// same item again on the same page
+		"https://gopher.bandcamp.com/album/new",
+		"",
+	))
+
+	want := []string{"https://gopher.bandcamp.com/album/new?from=discover_page"}
+	if got := getResultTitles(r.pending); !reflect.DeepEqual(got, want) {
+		t.Errorf(formatStr, "wrong pending results", want, got)
+	}
+
+	// radio only marks its own items, session is changed by playback
+	if len(sessionPlayed) != 1 {
+		t.Errorf(formatStr, "session was changed", 1, len(sessionPlayed))
+	}
+}
@@ -4,8 +4,8 @@ import (
 	"fmt"
 	"log"
 	"math/rand"
-	"os"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/gdamore/tcell/v2"
@@ -69,6 +69,12 @@ type windowLayout struct {
 	views.BoxLayout
 	screen tcell.Screen
 
+	// headless mode has event queue instead of screen
+	headless bool
+	events   chan tcell.Event
+	done     chan struct{}
+	quit     sync.Once
+
 	width       int
 	height      int
 	orientation views.Orientation
@@ -88,19 +94,38 @@ type windowLayout struct {
 	imageSize   int
 
 	searchResults *DiscoverResult
+	releases      *releaseList
+	radio         *radioStation
 	waiting       bool
-	// TODO: image cache
-	coverKey    string
-	coverBG     tcell.Color
-	coverFG     tcell.Color
-	coverAccent tcell.Color
+	coverKey      string
+	coverBG       tcell.Color
+	coverFG       tcell.Color
+	coverAccent   tcell.Color
+
+	// search results before filter was applied
+	allResults   []Result
+	resultFilter *resultFilter
 
 	boundx, boundy int
-	playlist       *album
+	playlist       *playQueue
+
+	// session is restored when screen is ready, track is resumed
+	// from saved position after it's fully downloaded
+	session        *session
+	resumePosition time.Duration
 }
 
 func (window *windowLayout) sendEvent(event tcell.Event) {
 
+	if window.headless {
+		if event, ok := event.(*eventDebugMessage); ok {
+			log.Println("[dbg]:", event)
+			return
+		}
+		window.post(event)
+		return
+	}
+
 	if window.screen == nil {
 		return
 	}
@@ -201,37 +226,91 @@ func (window *windowLayout) getImageURL(artID uint64) string {
 		strconv.FormatUint(artID, 10) + s
 }
 
+// loadCover shows album art from cache, if it's not there, art is downloaded
+func (window *windowLayout) loadCover(artID uint64) {
+	// cover is never shown
+	if window.headless {
+		return
+	}
+
+	url := window.getImageURL(artID)
+	if url == "" {
+		window.coverKey = ""
+		window.sendEvent(newCoverDownloaded(nil, ""))
+		return
+	}
+
+	window.coverKey = url
+	key := getImageKey(artID, window.imageSize)
+	if img, ok := images.get(key); ok {
+		window.sendEvent(newCoverDownloaded(img, url))
+		return
+	}
+	downloads.cover(url, key)
+}
+
+// url of the album that current track comes from
 func (window *windowLayout) getItemURL() string {
-	if window.playlist == nil {
+	item, _ := window.playlist.get(player.currentTrack)
+	if item == nil {
 		return ""
 	}
-	return window.playlist.url
+	return item.url
+}
+
+// isPreview reports whether featured track of search result is playing
+func (window *windowLayout) isPreview() bool {
+	item, _ := window.playlist.get(player.currentTrack)
+	return item != nil && item.preview
 }
 
 // returns true and url if any streamable media was found
 func (window *windowLayout) getTrackURL(track int) (string, bool) {
-	if window.playlist == nil {
+	_, t := window.playlist.get(track)
+	if t == nil {
 		return "", false
 	}
 
-	if url := window.playlist.tracks[track].url; url != "" {
+	if url := t.url; url != "" {
 		return url, true
 	} else {
 		return "", false
 	}
 }
 
+// cache key for the track, media urls expire, track id doesn't
+func (window *windowLayout) getTrackKey(track int) string {
+	_, t := window.playlist.get(track)
+	if t == nil {
+		return ""
+	}
+
+	if t.id != 0 {
+		return fmt.Sprint("track: ", t.id)
+	}
+	return getTruncatedURL(t.url)
+}
+
+func (window *windowLayout) getTrackDuration(track int) float64 {
+	_, t := window.playlist.get(track)
+	if t == nil {
+		return 0
+	}
+	return t.duration
+}
+
 func (window *windowLayout) getArtID() uint64 {
-	if window.playlist == nil {
+	item, _ := window.playlist.get(player.currentTrack)
+	if item == nil {
 		return 0
 	}
-	return window.playlist.artID
+	return item.artID
 }
 
 func (window *windowLayout) getNewTrack(track int) {
+	window.markPlayed(track)
 	if url, streamable := window.getTrackURL(track); streamable {
-		wg.Add(1)
-		go downloadMedia(url, track)
+		downloads.media(url, window.getTrackKey(track), track, false)
 	} else {
 		window.sendEvent(newMessage(fmt.Sprintf("track %d is not available for streaming",
 			track+1)))
@@ -239,7 +318,201 @@ func (window *windowLayout) getNewTrack(track int) {
 	}
 }
 
+// download track that goes after current one in advance,
+// player will switch to it without any pause
+func (window *windowLayout) preloadNextTrack() {
+	if !player.isPlaying() {
+		return
+	}
+
+	track, ok := player.getNextTrack()
+	if !ok {
+		return
+	}
+
+	if url, streamable := window.getTrackURL(track); streamable {
+		downloads.media(url, window.getTrackKey(track), track, true)
+	}
+}
+
+// restoreQueue fills queue with tracks from previous session,
+// tracks of pages that failed to load are skipped
+func (window *windowLayout) restoreQueue(s *session, items []*album) {
+	// something else could be opened while session was restored
+	if !window.playlist.isEmpty() {
+		return
+	}
+
+	track, found := 0, false
+	for i, entry := range s.Queue {
+		if entry.Item < 0 || entry.Item >= len(items) || items[entry.Item] == nil {
+			continue
+		}
+
+		n := window.playlist.len()
+		window.playlist.add(items[entry.Item], entry.Track)
+		if i == s.Track && window.playlist.len() > n {
+			track, found = n, true
+		}
+	}
+
+	if window.playlist.isEmpty() {
+		window.sendEvent(newMessage("failed to restore session"))
+		return
+	}
+
+	player.stop()
+	player.clearStream()
+	player.currentTrack = track
+	player.totalTracks = window.playlist.len()
+	if found {
+		window.resumePosition = s.Position
+	}
+	window.getNewTrack(track)
+	window.loadCover(window.getArtID())
+}
+
+// setSearchResults replaces search results, filter is removed
+func (window *windowLayout) setSearchResults(result *DiscoverResult) {
+	window.searchResults = result
+	window.allResults = result.Results
+	window.resultFilter = nil
+}
+
+// addSearchResults merges next page of results, current filter is
+// applied to them too, number of new items is returned
+func (window *windowLayout) addSearchResults(result *DiscoverResult) int {
+	var added int
+	window.searchResults.Cursor = result.Cursor
+	window.allResults, added = mergeResults(window.allResults, result.Results)
+	window.searchResults.Results = window.resultFilter.apply(window.allResults)
+	window.searchResults.BatchResultCount += uint64(added)
+	return added
+}
+
+// replaceQueue starts playback of the new item from the first track
+func (window *windowLayout) replaceQueue(item *album) {
+	player.stop()
+	player.clearStream()
+	window.resumePosition = 0
+	window.playlist.replace(item)
+	// FIXME: direct access to player data
+	player.currentTrack = 0
+	player.totalTracks = window.playlist.len()
+	window.getNewTrack(player.currentTrack)
+
+	window.loadCover(item.artID)
+}
+
+// addToQueue puts all tracks of the item at the end of the queue
+// or right after current track
+func (window *windowLayout) addToQueue(item *album, mode queueMode) {
+	pos := window.playlist.len()
+	if mode == queueNext {
+		pos = player.currentTrack + 1
+	}
+
+	n := window.playlist.insert(item, pos)
+	window.queueChanged()
+
+	if n == 1 {
+		window.sendEvent(newMessage("1 track added to queue"))
+	} else {
+		window.sendEvent(newMessage(fmt.Sprintf("%d tracks added to queue", n)))
+	}
+}
+
+// playPreview plays item right after current track, previous preview
+// takes its place, so previewing results one after another leaves only
+// one of them in the queue
+func (window *windowLayout) playPreview(item *album) {
+	pos := player.currentTrack + 1
+	if window.isPreview() {
+		pos = player.currentTrack
+		window.playlist.remove(pos)
+	}
+
+	window.playlist.insert(item, pos)
+	player.totalTracks = window.playlist.len()
+	player.dropPending()
+	window.resumePosition = 0
+	player.setTrack(pos)
+}
+
+// removeFromQueue removes track from the queue, if it was playing,
+// playback continues from the track that took its place
+func (window *windowLayout) removeFromQueue(pos int) {
+	if pos < 0 || pos >= window.playlist.len() {
+		return
+	}
+	window.playlist.remove(pos)
+
+	switch {
+	case window.playlist.isEmpty():
+		player.stop()
+		player.clearStream()
+		player.currentTrack = 0
+
+	case pos < player.currentTrack:
+		player.currentTrack--
+
+	case pos == player.currentTrack:
+		playing := player.isPlaying()
+		player.stop()
+		player.clearStream()
+		if pos >= window.playlist.len() {
+			player.currentTrack = window.playlist.len() - 1
+		} else if playing {
+			player.totalTracks = window.playlist.len()
+			player.setTrack(pos)
+		}
+	}
+
+	window.queueChanged()
+}
+
+// moveInQueue moves track one position up or down the queue
+func (window *windowLayout) moveInQueue(pos, direction int) bool {
+	to := pos + direction
+	if !window.playlist.move(pos, to) {
+		return false
+	}
+
+	switch player.currentTrack {
+	case pos:
+		player.currentTrack = to
+	case to:
+		player.currentTrack = pos
+	}
+
+	window.queueChanged()
+	return true
+}
+
+// keeps player in sync with modified queue, next track might be
+// different now
+func (window *windowLayout) queueChanged() {
+	player.totalTracks = window.playlist.len()
+	player.dropPending()
+	window.preloadNextTrack()
+}
+
+// content shows current state of player and lists,
+// there is nothing to update in headless mode
+func (window *windowLayout) updateContent(event tcell.Event) bool {
+	if window.headless {
+		return true
+	}
+	return window.widgets[content].HandleEvent(event)
+}
+
 func (window *windowLayout) Resize() {
+	// first resize happens right after screen initialization
+	if s := window.session; s != nil {
+		window.session = nil
+		s.restore()
+	}
+
 	window.width, window.height = window.screen.Size()
 	window.checkOrientation()
 	window.sendEvent(&eventRefitArt{})
@@ -251,54 +524,163 @@ func (window *windowLayout) HandleEvent(event tcell.Event) bool {
 	switch event := event.(type) {
 
 	case *eventNewItem:
-		if event.value() != nil {
-			player.stop()
-			player.clearStream()
-			window.playlist = event.value()
-			// FIXME: direct access to player data
-			player.currentTrack = 0
-			window.getNewTrack(player.currentTrack)
-
-			imageURL := window.getImageURL(window.playlist.artID)
-			window.coverKey = imageURL
-			wg.Add(1)
-			go downloadCover(imageURL)
-			player.totalTracks = event.value().totalTracks
-			return window.widgets[content].HandleEvent(event)
+		if event.value() == nil {
+			return true
+		}
+
+		// empty queue is replaced anyway
+		if event.getMode() != queueReplace && event.getMode() != queuePreview &&
+			!window.playlist.isEmpty() {
+			window.addToQueue(event.value(), event.getMode())
+			return window.updateContent(event)
+		}
+
+		// preview doesn't touch the rest of the queue
+		if event.getMode() == queuePreview && !window.playlist.isEmpty() {
+			window.playPreview(event.value())
+			return window.updateContent(event)
+		}
+
+		// anything opened by user ends radio
+		if event.getMode() == queueReplace {
+			window.stopRadio()
+		}
+
+		window.replaceQueue(event.value())
+		return window.updateContent(event)
+
+	case *eventRadioStart:
+		window.startRadio(event.value())
+		return true
+
+	case *eventRadioPage:
+		r := event.station
+		if r != window.radio {
+			return true
+		}
+
+		r.fetching = false
+		if result := event.value(); result != nil {
+			r.add(result)
+		} else {
+			r.next = nil
+		}
+		r.fill()
+		return true
+
+	case *eventRadioItem:
+		r := event.station
+		if r != window.radio {
+			return true
+		}
+
+		r.loading = false
+		if item := event.value(); item != nil {
+			window.addRadioItem(item)
 		}
+		r.fill()
 		return true
 
 		// FIXME: isn't it possible to call next track on
 		// album change? (and get out of range)
 		// second one fixed?
 		// first one won't be fixed for now, not a major problem
+	case *eventControl:
+		event.reply <- window.execute(event.value())
+		return true
+
+	case *eventSessionRestored:
+		window.restoreQueue(event.value(), event.getItems())
+		return window.updateContent(event)
+
 	case *eventNewTrack:
+		// on fast switching only last track matters
+		if event.value() != player.currentTrack {
+			return true
+		}
+		window.resumePosition = 0
 		window.getNewTrack(event.value())
-		return window.widgets[content].HandleEvent(event)
+		window.radio.fill()
+		return window.updateContent(event)
 
 	case *eventNextTrack:
-		player.nextTrack()
+		if !event.value() {
+			player.nextTrack()
+			return true
+		}
+
+		player.advance()
+		window.markPlayed(player.currentTrack)
+		window.preloadNextTrack()
+		window.radio.fill()
+		return window.updateContent(event)
+
+	case *eventTrackPreloaded:
+		_, ok := window.getTrackURL(event.getTrack())
+		if ok && event.getTrack() == player.pending &&
+			event.value() == window.getTrackKey(event.getTrack()) {
+			player.queue(event.value())
+		}
 		return true
 
+	case *eventTrackBuffered:
+		if _, ok := window.getTrackURL(player.currentTrack); !ok {
+			return false
+		}
+
+		// seeking is not possible until track is downloaded,
+		// playback will start later
+		if window.resumePosition > 0 {
+			return true
+		}
+
+		if event.value() == window.getTrackKey(player.currentTrack) {
+			if player.status == playing {
+				player.stop()
+				player.clearStream()
+			}
+			player.play(event.value(),
+				window.getTrackDuration(player.currentTrack))
+			return true
+		}
+
 	case *eventTrackDownloaded:
 		track := player.currentTrack
-		url, ok := window.getTrackURL(track)
-		if !ok {
+		if _, ok := window.getTrackURL(track); !ok {
 			return false
 		}
 
-		if event.value() == getTruncatedURL(url) {
+		if event.value() == window.getTrackKey(track) {
+			if player.isStreaming(event.value()) {
+				player.complete(event.value())
+				window.preloadNextTrack()
+				return true
+			}
+
 			if player.status == playing {
 				player.stop()
 				player.clearStream()
 			}
-			player.play(event.value())
+			player.play(event.value(), window.getTrackDuration(track))
+			if window.resumePosition > 0 {
+				if err := player.seekTo(window.resumePosition); err != nil {
+					window.sendEvent(newErrorMessage(err))
+				}
+				window.resumePosition = 0
+			}
+			window.preloadNextTrack()
 			return true
 		}
 
 	case *eventUpdate:
+		if watchers.active() {
+			watchers.update(getPlayerState())
+		}
+		if window.headless {
+			return true
+		}
 		app.Update()
-		return window.widgets[content].HandleEvent(event)
+		return window.updateContent(event)
 
 	case *tcell.EventKey:
 		switch event.Key() {
@@ -358,7 +740,7 @@ func (window *windowLayout) HandleEvent(event tcell.Event) bool {
 
 				// TODO: remove later
 				case 'h', 'H':
-					return window.widgets[content].HandleEvent(event)
+					return window.updateContent(event)
 
 				// TODO: handle player events here, right now all runes go
 				// to player
@@ -370,6 +752,10 @@ func (window *windowLayout) HandleEvent(event tcell.Event) bool {
 			}
 		}
 	}
+
+	if window.headless {
+		return false
+	}
 	return window.BoxLayout.HandleEvent(event)
 }
 
@@ -402,9 +788,15 @@ func (window *windowLayout) handlePlayerControls(key rune) bool {
 
 	case 'r', 'R':
 		player.nextMode()
+		window.preloadNextTrack()
 		window.displayIfHidden("mode " + player.getPlaybackMode())
 		return true
 
+	case 'c', 'C':
+		player.toggleCrossfade()
+		window.displayIfHidden("crossfade " + player.getCrossfade())
+		return true
+
 	case 'b', 'B':
 		// FIXME: this code should not be here
 		// jump to start instead of previous track if current position
@@ -575,12 +967,12 @@ func (s *spacer) Size() (int, int) {
 }
 
 func init() {
-	var err error
 	window.hideInput = true
 	window.hMargin, window.vMargin = 3, 1
 	window.bgColor = bgColor
 	window.fgColor = fgColor
 	window.imageSize = 1
+	window.playlist = newQueue()
 
 	window.widgets[spacerV1] = &spacer{views.NewText(), false}
 	window.widgets[spacerH1] = &spacer{views.NewText(), false}
@@ -603,15 +995,18 @@ func init() {
 	contentVLayoutOuter.AddWidget(window.widgets[spacerH1], 0.0)
 	contentVLayoutOuter.AddWidget(contentHLayout, 0.0)
 	window.AddWidget(contentVLayoutOuter, 1.0)
+}
 
+func initScreen() error {
 	// create new screen to gain access to actual terminal dimensions
 	// works on unix and windows, unlike ascii2image dependency
 	s, err := tcell.NewScreen()
 	if err != nil {
-		log.Println(err)
-		os.Exit(1)
+		return err
 	}
+
 	window.screen = &screen{s}
 	app.SetScreen(window.screen)
 	app.SetRootWidget(window)
+	return nil
 }
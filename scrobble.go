@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// https://listenbrainz.readthedocs.io/en/latest/users/api/core.html
+	defaultScrobbleURL = "https://api.listenbrainz.org"
+	// listen is submitted after half of the track or 4 minutes
+	scrobbleThreshold = 4 * 60
+	// max number of listens in one request
+	scrobbleBatchSize = 1000
+	scrobbleRetry     = 5 * time.Minute
+	scrobbleTimeout   = 30 * time.Second
+)
+
+// listen as defined by ListenBrainz API, same format is accepted
+// by other services (Maloja, multi-scrobbler, etc)
+type listen struct {
+	ListenedAt    int64         `json:"listened_at,omitempty"`
+	TrackMetadata trackMetadata `json:"track_metadata"`
+}
+
+type trackMetadata struct {
+	ArtistName     string         `json:"artist_name"`
+	TrackName      string         `json:"track_name"`
+	ReleaseName    string         `json:"release_name,omitempty"`
+	AdditionalInfo map[string]any `json:"additional_info,omitempty"`
+}
+
+type submission struct {
+	ListenType string   `json:"listen_type"`
+	Payload    []listen `json:"payload"`
+}
+
+// scrobbler submits played tracks, listens that weren't submitted
+// are stored on disk and sent later
+type scrobbler struct {
+	url    string
+	token  string
+	client *http.Client
+
+	// listens waiting to be submitted, file is the source of truth
+	sync.Mutex
+	path    string
+	pending []listen
+
+	states chan playerState
+	flush  chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	// current play, only accessed by watch
+	tracker   playTracker
+	submitted bool
+}
+
+func getScrobblesPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gobandcamp", "scrobbles.json"), nil
+}
+
+// newScrobbler starts watching player, listens from previous
+// sessions are submitted right away
+func newScrobbler(url, token string) (*scrobbler, error) {
+	s := &scrobbler{
+		url:    strings.TrimSuffix(url, "/"),
+		token:  token,
+		client: &http.Client{Timeout: scrobbleTimeout},
+		flush:  make(chan struct{}, 1),
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+
+	path, err := getScrobblesPath()
+	if err == nil {
+		s.path = path
+		err = s.load()
+	}
+
+	s.states = watchers.subscribe()
+	s.wg.Add(2)
+	go s.watch()
+	go s.submit()
+	s.flush <- struct{}{}
+	return s, err
+}
+
+func (s *scrobbler) Close() {
+	watchers.unsubscribe(s.states)
+	s.cancel()
+	s.wg.Wait()
+}
+
+// load reads listens that weren't submitted before
+func (s *scrobbler) load() error {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	return json.Unmarshal(data, &s.pending)
+}
+
+// must be called with lock held
+func (s *scrobbler) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	if len(s.pending) == 0 {
+		err := os.Remove(s.path)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(s.pending)
+	if err != nil {
+		return err
+	}
+
+	// same as cache, file is never partially written
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// watch follows current track, listen is submitted only once per play
+func (s *scrobbler) watch() {
+	defer s.wg.Done()
+
+	for state := range s.states {
+		if s.tracker.update(state) {
+			s.submitted = false
+			if state.Status == "playing" && state.Track > 0 {
+				go s.nowPlaying(newListen(state, 0))
+			}
+			continue
+		}
+
+		threshold := math.Min(state.Duration/2, scrobbleThreshold)
+		if !s.submitted && state.Track > 0 && state.Duration > 0 &&
+			s.tracker.played >= threshold {
+			s.submitted = true
+			s.add(newListen(state, state.Started))
+		}
+	}
+}
+
+func newListen(state playerState, listenedAt int64) listen {
+	return listen{
+		ListenedAt: listenedAt,
+		TrackMetadata: trackMetadata{
+			ArtistName:  state.Artist,
+			TrackName:   state.Title,
+			ReleaseName: state.Album,
+			AdditionalInfo: map[string]any{
+				"duration_ms":       int64(state.Duration * 1000),
+				"origin_url":        state.URL,
+				"media_player":      "gobandcamp",
+				"submission_client": "gobandcamp",
+			},
+		},
+	}
+}
+
+// add stores listen on disk first, then submits it
+func (s *scrobbler) add(l listen) {
+	s.Lock()
+	s.pending = append(s.pending, l)
+	err := s.save()
+	s.Unlock()
+	if err != nil {
+		log.Printf("[err]: scrobbler: %v", err)
+	}
+
+	select {
+	case s.flush <- struct{}{}:
+	default:
+	}
+}
+
+// submit sends pending listens, if it fails, they are sent again later
+func (s *scrobbler) submit() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(scrobbleRetry)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-s.flush:
+		case <-ticker.C:
+		}
+
+		if err := s.submitPending(); err != nil {
+			log.Printf("[err]: scrobbler: %v", err)
+		}
+	}
+}
+
+func (s *scrobbler) submitPending() error {
+	for {
+		s.Lock()
+		n := min(len(s.pending), scrobbleBatchSize)
+		batch := append([]listen(nil), s.pending[:n]...)
+		s.Unlock()
+		if n == 0 {
+			return nil
+		}
+
+		listenType := "import"
+		if n == 1 {
+			listenType = "single"
+		}
+
+		err := s.send(&submission{ListenType: listenType, Payload: batch})
+		// listens that were rejected won't be accepted later either
+		var rejected *scrobbleError
+		if errors.As(err, &rejected) && rejected.code == http.StatusBadRequest {
+			log.Printf("[err]: scrobbler: dropped %d listens: %v", n, err)
+		} else if err != nil {
+			return err
+		}
+
+		s.Lock()
+		s.pending = s.pending[n:]
+		err = s.save()
+		s.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// now playing is not stored, it doesn't matter later
+func (s *scrobbler) nowPlaying(l listen) {
+	err := s.send(&submission{ListenType: "playing_now", Payload: []listen{l}})
+	if err != nil {
+		log.Printf("[err]: scrobbler: now playing: %v", err)
+	}
+}
+
+type scrobbleError struct {
+	code    int
+	message string
+}
+
+func (err *scrobbleError) Error() string {
+	return fmt.Sprintf("%d %s: %s", err.code, http.StatusText(err.code), err.message)
+}
+
+func (s *scrobbler) send(sub *submission) error {
+	data, err := json.Marshal(sub)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(s.ctx, http.MethodPost,
+		s.url+"/1/submit-listens", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Token "+s.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode != http.StatusOK {
+		return &scrobbleError{code: resp.StatusCode,
+			message: strings.TrimSpace(string(body))}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// same search as in the header of every bandcamp page
+const searchURL = "https://bandcamp.com/api/bcsearch_public_api/1/autocomplete_elastic"
+
+type SearchRequest struct {
+	SearchText   string `json:"search_text"`
+	SearchFilter string `json:"search_filter"`
+	FullPage     bool   `json:"full_page"`
+	FanID        *int64 `json:"fan_id"`
+}
+
+type SearchResponse struct {
+	Auto struct {
+		Results []SearchResult `json:"results"`
+	} `json:"auto"`
+}
+
+// SearchResult type is one of:
+// b - artist or label, a - album, t - track, f - fan
+type SearchResult struct {
+	Type        string  `json:"type"`
+	ID          uint64  `json:"id"`
+	ArtID       *uint64 `json:"art_id"`
+	Name        string  `json:"name"`
+	BandName    string  `json:"band_name"`
+	AlbumName   string  `json:"album_name"`
+	ItemURLRoot string  `json:"item_url_root"`
+	ItemURLPath string  `json:"item_url_path"`
+	Location    string  `json:"location"`
+	IsLabel     bool    `json:"is_label"`
+}
+
+// parseSearchResponse makes list of releases from search results,
+// artists and labels are listed with their location
+func parseSearchResponse(reader io.Reader, query string) (*releaseList, error) {
+	var response SearchResponse
+	if err := json.NewDecoder(reader).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	list := &releaseList{name: query}
+	for _, result := range response.Auto.Results {
+		item := release{
+			title: result.Name,
+			url:   result.ItemURLPath,
+		}
+		if item.url == "" {
+			item.url = result.ItemURLRoot
+		}
+		if result.ArtID != nil {
+			item.artID = *result.ArtID
+		}
+
+		switch result.Type {
+		case "b":
+			item.kind = "artist"
+			if result.IsLabel {
+				item.kind = "label"
+			}
+			item.artist = result.Location
+		case "a":
+			item.kind = "album"
+			item.artist = result.BandName
+		case "t":
+			item.kind = "track"
+			item.artist = result.BandName
+		case "f":
+			item.kind = "fan"
+			item.artist = result.Location
+		default:
+			continue
+		}
+
+		list.releases = append(list.releases, item)
+	}
+
+	return list, nil
+}
+
+func processSiteSearch(ctx context.Context, query string) {
+	window.sendEvent(newMessage("fetching data..."))
+
+	list, err := makeSearchRequest(ctx, &SearchRequest{SearchText: query})
+	if ctx.Err() != nil {
+		return
+	}
+
+	if err != nil {
+		window.sendEvent(newErrorMessage(err))
+		return
+	}
+
+	if len(list.releases) == 0 {
+		window.sendEvent(newMessage("nothing was found"))
+		return
+	}
+
+	window.sendEvent(newMessage(fmt.Sprintf("found %d results", len(list.releases))))
+	window.sendEvent(newReleases(list))
+}
+
+func makeSearchRequest(ctx context.Context, req *SearchRequest) (*releaseList, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, searchURL,
+		bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	r.Header.Set("Accept", "*/*")
+	r.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64; rv:120.0) Gecko/20100101 Firefox/120.0")
+	r.Header.Set("Content-Type", "application/json; charset=UTF-8")
+
+	resp, err := client.Do(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("got unexpected response: %s\n%w", resp.Status, err)
+		}
+		return nil, fmt.Errorf("got unexpected response: %s\n%s", resp.Status, data)
+	}
+
+	return parseSearchResponse(resp.Body, req.SearchText)
+}
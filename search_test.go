@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseSearchResponse(t *testing.T) {
+	file, err := os.Open("testdata/search_response.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	list, err := parseSearchResponse(file, "gopher")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if list.name != "gopher" || list.label {
+		t.Errorf(formatStr, "wrong list name", "gopher", list.name)
+	}
+
+	want := []release{
+		{
+			kind:   "artist",
+			title:  "Gopher & Friends",
+			artist: "Berlin, Germany",
+			url:    "https://gopher.bandcamp.com",
+		},
+		{
+			kind:  "label",
+			title: "Gopher Records",
+			url:   "https://gopherrecords.bandcamp.com",
+		},
+		{
+			kind:   "album",
+			title:  "First & Best",
+			artist: "Gopher & Friends",
+			url:    "https://gopher.bandcamp.com/album/first",
+			artID:  456,
+		},
+		{
+			kind:   "track",
+			title:  "Second",
+			artist: "Gopher & Friends",
+			url:    "https://gopher.bandcamp.com/track/second",
+			artID:  99,
+		},
+		{
+			kind:  "fan",
+			title: "gopher fan",
+			url:   "https://bandcamp.com/gopherfan",
+		},
+	}
+
+	if len(list.releases) != len(want) || len(list.roster) != 0 {
+		t.Fatalf(formatStr, "wrong number of results", len(want), len(list.releases))
+	}
+
+	for i := range want {
+		if list.releases[i] != want[i] {
+			t.Errorf(formatStr, "wrong result", want[i], list.releases[i])
+		}
+	}
+
+	for i, media := range []bool{false, false, true, true, false} {
+		if list.releases[i].isMedia() != media {
+			t.Errorf(formatStr, "wrong media flag for "+list.releases[i].kind,
+				media, !media)
+		}
+	}
+}
+
+func TestParseSearchResponseEmpty(t *testing.T) {
+	list, err := parseSearchResponse(strings.NewReader(`{"auto":{"results":[]}}`), "nothing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.releases) != 0 {
+		t.Errorf(formatStr, "wrong number of results", 0, len(list.releases))
+	}
+
+	_, err = parseSearchResponse(strings.NewReader(`<html>`), "nothing")
+	if err == nil {
+		t.Error("malformed response should fail")
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// session is written on exit and can be restored on next start,
+// queue keeps urls of pages, media urls expire and have to be
+// fetched again anyway
+type session struct {
+	Items    []string       `json:"items"`
+	Queue    []sessionEntry `json:"queue"`
+	Track    int            `json:"track"`
+	Position time.Duration  `json:"position"`
+	Volume   float64        `json:"volume"`
+	Muted    bool           `json:"muted"`
+	Mode     playbackMode   `json:"mode"`
+	Theme    int            `json:"theme"`
+	ArtMode  int            `json:"art_mode"`
+}
+
+// track of the item from the list of pages
+type sessionEntry struct {
+	Item  int `json:"item"`
+	Track int `json:"track"`
+}
+
+func getSessionPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gobandcamp", "session.json"), nil
+}
+
+// newSession collects current state of the player,
+// must be called when app is not running
+func newSession() *session {
+	s := &session{
+		Track:    player.currentTrack,
+		Position: player.getPosition().Truncate(time.Second),
+		Volume:   player.volume,
+		Muted:    player.muted,
+		Mode:     player.playbackMode,
+		Theme:    window.theme,
+		ArtMode:  window.widgets[art].(*artArea).model.artDrawingMode,
+	}
+
+	items := make(map[*album]int)
+	for _, entry := range window.playlist.entries {
+		n, ok := items[entry.item]
+		if !ok {
+			n = len(s.Items)
+			items[entry.item] = n
+			s.Items = append(s.Items, entry.item.url)
+		}
+		s.Queue = append(s.Queue, sessionEntry{Item: n, Track: entry.track})
+	}
+
+	return s
+}
+
+// saveSession writes session file, nothing is written if queue
+// is empty, so session saved before is not lost
+func saveSession() error {
+	if window.playlist.isEmpty() {
+		return nil
+	}
+
+	path, err := getSessionPath()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(newSession(), "", "    ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0o644)
+}
+
+// loadSession reads session saved on previous exit,
+// nil is returned if there is none
+func loadSession() (*session, error) {
+	path, err := getSessionPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var s session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// restore applies saved settings, queue is restored after
+// all of its pages are fetched
+func (s *session) restore() {
+	if s.Volume >= 0 && s.Volume <= 1 {
+		player.volume = s.Volume
+	}
+	player.muted = s.Muted
+	if s.Mode >= normal && s.Mode <= random {
+		player.playbackMode = s.Mode
+	}
+
+	if s.Theme >= 0 && s.Theme < 5 {
+		window.theme = s.Theme
+		window.setTheme(s.Theme)
+	}
+
+	if s.ArtMode >= 0 && s.ArtMode < 6 {
+		window.widgets[art].(*artArea).model.artDrawingMode = s.ArtMode
+		window.sendEvent(&eventCheckDrawMode{})
+	}
+
+	if len(s.Items) > 0 {
+		downloads.session(s)
+	}
+}
+
+// fetchSessionItems fetches every page from saved queue,
+// pages that failed to load are nil
+func fetchSessionItems(ctx context.Context, s *session) {
+	window.sendEvent(newMessage("restoring session..."))
+
+	items := make([]*album, len(s.Items))
+	for i, link := range s.Items {
+		item, err := fetchMediaPage(ctx, link)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			window.sendEvent(newErrorMessage(err))
+		}
+		items[i] = item
+	}
+
+	window.sendEvent(newSessionRestored(s, items))
+}
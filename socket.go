@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// sendCommand passes command to the event loop and waits for result
+func sendCommand(cmd command) controlReply {
+	event := newControl(cmd)
+	window.sendEvent(event)
+
+	select {
+	case reply := <-event.reply:
+		return reply
+	case <-time.After(controlTimeout):
+		return controlReply{Error: "timed out"}
+	}
+}
+
+// default location of the control socket, runtime directory is
+// preferred, since it's private to the user
+func getSocketPath() string {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		return filepath.Join(os.TempDir(),
+			fmt.Sprintf("gobandcamp-%d.sock", os.Getuid()))
+	}
+	return filepath.Join(dir, "gobandcamp.sock")
+}
+
+// controlServer accepts commands over unix socket, one command per line,
+// every command gets one line of json in response
+type controlServer struct {
+	listener net.Listener
+	path     string
+}
+
+func newControlServer(path string) (*controlServer, error) {
+	// socket could be left by instance that crashed, but if it still
+	// accepts connections, other instance is running
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return nil, errors.New("other instance is already listening on " + path)
+	}
+	os.Remove(path)
+
+	listener, err := listenSocket(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(path, 0o600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	server := &controlServer{listener: listener, path: path}
+	go server.serve()
+	return server, nil
+}
+
+func (server *controlServer) serve() {
+	for {
+		conn, err := server.listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		} else if err != nil {
+			log.Printf("[err]: control socket: %v", err)
+			continue
+		}
+		go server.handle(conn)
+	}
+}
+
+func (server *controlServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	enc := json.NewEncoder(conn)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		var reply controlReply
+		if cmd, err := parseCommand(scanner.Text()); err != nil {
+			reply.Error = err.Error()
+		} else {
+			reply = sendCommand(cmd)
+		}
+
+		if err := enc.Encode(&reply); err != nil {
+			return
+		}
+	}
+}
+
+func (server *controlServer) Close() error {
+	err := server.listener.Close()
+	os.Remove(server.path)
+	return err
+}
+
+// runClient is a "ctl" mode, it sends single command to running
+// instance and prints response
+func runClient(args []string) int {
+	f := flag.NewFlagSet("ctl", flag.ContinueOnError)
+	f.SetOutput(os.Stderr)
+	socket := f.String("socket", getSocketPath(), "path of the control `socket`")
+	f.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s ctl [-socket path] command [args]\n\n"+
+			"commands:\n"+
+			"  status, play, pause, toggle, stop, next, prev, quit\n"+
+			"  seek [+|-]seconds, volume [+|-]percents\n"+
+			"  open url, add url, search [options] tags\n"+
+			"  queue, results\n\n", os.Args[0])
+		f.PrintDefaults()
+	}
+
+	if err := f.Parse(args); err != nil {
+		return 2
+	}
+
+	if f.NArg() == 0 {
+		f.Usage()
+		return 2
+	}
+
+	conn, err := net.DialTimeout("unix", *socket, time.Second)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gobandcamp is not running:", err)
+		return 1
+	}
+	defer conn.Close()
+
+	cmd := command{Name: f.Arg(0), Args: f.Args()[1:]}
+	if err := json.NewEncoder(conn).Encode(&cmd); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	var reply controlReply
+	if err := json.Unmarshal(line, &reply); err != nil {
+		fmt.Fprintln(os.Stderr, "unexpected response:", err)
+		return 1
+	}
+
+	if !reply.OK {
+		fmt.Fprintln(os.Stderr, reply.Error)
+		return 1
+	}
+
+	os.Stdout.Write(line)
+	return 0
+}
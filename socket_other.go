@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "net"
+
+// there is no umask, permissions are only changed after socket is created
+func listenSocket(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
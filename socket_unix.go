@@ -0,0 +1,16 @@
+//go:build unix
+
+package main
+
+import (
+	"net"
+	"syscall"
+)
+
+// listenSocket creates socket that only owner can connect to, mask
+// is set before socket file appears, so it's never open to others
+func listenSocket(path string) (net.Listener, error) {
+	mask := syscall.Umask(0o077)
+	defer syscall.Umask(mask)
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"sync"
+)
+
+type length interface {
+	Length() int64
+}
+
+// stream joins decoded tracks together, when current source runs out
+// reading continues from the queued one, audio player never sees the end
+// of the stream and there is no gap between tracks
+type stream struct {
+	sync.Mutex
+	current  io.ReadSeeker
+	next     io.ReadSeeker
+	size     int64
+	nextSize int64
+
+	// positions in bytes as audio player sees them,
+	// base is where current source starts
+	pos   int64
+	base  int64
+	ended bool
+
+	// length of crossfade in bytes, fadeLength is actual length of
+	// current fade, it is shorter if next source was queued too late,
+	// nextPos is how much was already read from next source while mixing
+	fade       int64
+	fadeLength int64
+	nextPos    int64
+	buf        []byte
+
+	// called outside of lock, true if reading continued from queued source
+	f func(switched bool)
+}
+
+func newStream(reader io.Reader, size int64, f func(bool)) *stream {
+	r, ok := reader.(io.ReadSeeker)
+	if !ok {
+		panic("provided io.Reader must implement io.Seeker")
+	}
+
+	return &stream{current: r, size: size, f: f}
+}
+
+func (s *stream) Read(p []byte) (int, error) {
+	s.Lock()
+	var n int
+	var err error
+	left := s.size - s.pos + s.base
+	switch {
+	case s.next != nil && left <= s.fade:
+		n, err = s.mix(p, left)
+	// don't read past the start of the fade
+	case s.next != nil && s.fade > 0 && int64(len(p)) > left-s.fade:
+		n, err = s.current.Read(p[:left-s.fade])
+	default:
+		n, err = s.current.Read(p)
+	}
+	s.pos += int64(n)
+
+	var switched, ended bool
+	if errors.Is(err, io.EOF) {
+		if s.next != nil {
+			// next source might be already partially played
+			s.base = s.pos - s.nextPos
+			s.current, s.size = s.next, s.nextSize
+			s.next, s.nextSize = nil, 0
+			s.nextPos, s.fadeLength = 0, 0
+			switched = true
+
+			// fill the rest of the buffer from the next source
+			var m int
+			m, err = s.current.Read(p[n:])
+			s.pos += int64(m)
+			n += m
+			if errors.Is(err, io.EOF) {
+				err = nil
+			}
+		} else if !s.ended {
+			s.ended = true
+			ended = true
+		}
+	}
+	s.Unlock()
+
+	if switched || ended {
+		s.f(switched)
+	}
+
+	return n, err
+}
+
+func (s *stream) Seek(offset int64, whence int) (int64, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	// current source might be not seekable, but position is known anyway
+	if whence == io.SeekCurrent && offset == 0 {
+		return s.pos, nil
+	}
+
+	switch whence {
+	case io.SeekStart:
+		offset -= s.base
+	case io.SeekCurrent:
+		offset += s.pos - s.base
+	case io.SeekEnd:
+		offset += s.size
+	}
+
+	if offset < 0 {
+		offset = 0
+	}
+
+	n, err := s.current.Seek(offset, io.SeekStart)
+	if err != nil {
+		return s.pos, err
+	}
+
+	// start fade again, if it was interrupted
+	if s.nextPos > 0 {
+		if _, err := s.next.Seek(0, io.SeekStart); err != nil {
+			return s.pos, err
+		}
+		s.nextPos, s.fadeLength = 0, 0
+	}
+
+	s.pos = s.base + n
+	s.ended = false
+	return s.pos, nil
+}
+
+// mix reads the ending of current source together with the beginning
+// of the next one, volume of the first fades out, second fades in,
+// returns io.EOF when current source is over
+func (s *stream) mix(p []byte, left int64) (int, error) {
+	// size of the source could be estimated, and source could
+	// give more than that, whatever is left of it is skipped
+	if left <= 0 {
+		return 0, io.EOF
+	}
+
+	// 2 channels, 4 bytes per sample
+	n := len(p) / 8 * 8
+	if int64(n) > left {
+		n = int(left)
+	}
+
+	if n == 0 {
+		return s.current.Read(p)
+	}
+
+	if s.fadeLength == 0 {
+		s.fadeLength = left
+	}
+
+	if len(s.buf) < n {
+		s.buf = make([]byte, n)
+	}
+
+	out, err := io.ReadFull(s.current, p[:n])
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return out, err
+	}
+
+	in, err := io.ReadFull(s.next, s.buf[:out])
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return out, err
+	}
+	s.nextPos += int64(in)
+
+	for i := 0; i+4 <= out; i += 4 {
+		// position of the frame inside of the fade from 0 to 1
+		t := float32(s.fadeLength-left+int64(i/8*8)) / float32(s.fadeLength)
+		a := math.Float32frombits(binary.LittleEndian.Uint32(p[i:]))
+
+		// next source might be shorter than the fade
+		var b float32
+		if i+4 <= in {
+			b = math.Float32frombits(binary.LittleEndian.Uint32(s.buf[i:]))
+		}
+		binary.LittleEndian.PutUint32(p[i:], math.Float32bits(a*(1-t)+b*t))
+	}
+
+	if int64(out) >= left || out < n {
+		return out, io.EOF
+	}
+
+	return out, nil
+}
+
+// queue sets source that will be played after current one,
+// nil reader removes already queued source
+func (s *stream) queue(reader io.ReadSeeker, size int64) {
+	s.Lock()
+	s.next, s.nextSize = reader, size
+	s.nextPos, s.fadeLength = 0, 0
+	s.Unlock()
+}
+
+// replace swaps current source with the same data in different form,
+// position inside of the source is kept
+func (s *stream) replace(reader io.ReadSeeker, size int64) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, err := reader.Seek(s.pos-s.base, io.SeekStart); err != nil {
+		return err
+	}
+
+	s.current, s.size = reader, size
+	return nil
+}
+
+// setFade sets length of crossfade between sources in bytes, 0 disables it
+func (s *stream) setFade(size int64) {
+	s.Lock()
+	s.fade = size / 8 * 8
+	s.Unlock()
+}
+
+// start returns position in bytes where current source begins
+func (s *stream) start() int64 {
+	s.Lock()
+	defer s.Unlock()
+	return s.base
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// makeSource returns n bytes, every byte is set to value
+func makeSource(n int, value byte) *bytes.Reader {
+	return bytes.NewReader(bytes.Repeat([]byte{value}, n))
+}
+
+// source with estimated size could be longer than that, stream
+// should still switch to the next one
+func TestStreamSourceLongerThanSize(t *testing.T) {
+	for _, fade := range []int64{0, 16} {
+		var switched int
+		s := newStream(makeSource(100, 1), 64, func(ok bool) {
+			if ok {
+				switched++
+			}
+		})
+		s.setFade(fade)
+
+		// whole source is read before next one is queued
+		p := make([]byte, 1024)
+		n, err := s.Read(p)
+		if err != nil || n != 100 {
+			t.Fatalf(formatStr, "wrong first read", 100, n)
+		}
+
+		s.queue(makeSource(32, 2), 32)
+		n, err = s.Read(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want := bytes.Repeat([]byte{2}, 32); !bytes.Equal(p[:n], want) {
+			t.Errorf(formatStr, "wrong data of next source", want, p[:n])
+		}
+		if switched != 1 {
+			t.Errorf(formatStr, "wrong number of switches", 1, switched)
+		}
+		if start := s.start(); start != 100 {
+			t.Errorf(formatStr, "wrong start of next source", 100, start)
+		}
+
+		if _, err := s.Read(p); err != io.EOF {
+			t.Errorf(formatStr, "stream should end", io.EOF, err)
+		}
+	}
+}